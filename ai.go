@@ -0,0 +1,355 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	AI_RANDOM = iota // Picks any move it can use.
+	AI_EASY          // Usually picks at random, but sometimes goes for the most damage.
+	AI_NORMAL        // Usually goes for the most damage.
+	AI_GREEDY        // Always goes for the most damage it can expect to do.
+
+	AI_DELAY = time.Second * 2 // How long an NPC waits before making its move, so people can keep up.
+)
+
+// The names used for difficulties in CHALLENGE and -difficulty.
+var difficulties = map[string]int{
+	"random": AI_RANDOM,
+	"easy":   AI_EASY,
+	"normal": AI_NORMAL,
+	"greedy": AI_GREEDY,
+}
+
+// How often each difficulty picks the move with the most expected damage,
+// rather than one at random.
+var greed = map[int]float64{
+	AI_RANDOM: 0,
+	AI_EASY:   0.3,
+	AI_NORMAL: 0.7,
+	AI_GREEDY: 1,
+}
+
+type Choice struct { // A move an NPC could make, and who it'd be aimed at.
+	move    *Move
+	group   *Group
+	targets []*Combatant
+	damage  float64 // How much damage it's expected to do to the other side, less any to its own.
+}
+
+func ParseDifficulty(name string) (int, error) {
+	difficulty, found := difficulties[strings.ToLower(name)]
+	if !found {
+		return 0, errors.New("Unknown difficulty " + name + "; pick random, easy, normal or greedy")
+	}
+	return difficulty, nil
+}
+
+// Whether nobody is controlling a combatant, so the server plays them.
+func (combatant *Combatant) IsAI() bool {
+	return combatant.Controller() == nil
+}
+
+// Whether anybody who isn't an NPC is still standing.
+func (battle *Battle) HasPlayers() bool {
+	for _, c := range battle.combatants {
+		if c.hp > 0 && c.client != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Add a character to the battle that the server plays, on the given team.
+func (battle *Battle) JoinNPC(character string, team, difficulty int) (*Combatant, error) {
+	player, found := GetPlayer(character)
+	if !found {
+		return nil, errors.New("There is no character named " + character)
+	}
+	if !player.aggressive {
+		return nil, errors.New(player.name + " isn't an NPC")
+	}
+	return battle.AddCombatant(player, nil, team, difficulty), nil
+}
+
+// If it's an NPC's turn, have them make their move once they've had a moment
+// to think about it.
+func (battle *Battle) ScheduleAI() {
+	if battle.state != BATTLE_ACTIVE || battle.replaying || !battle.Current().IsAI() {
+		return
+	}
+	battle.aiTurns++
+	if battle.room.sink == nil {
+		// Without a room to send it to, whatever's running the battle plays it.
+		return
+	}
+	id, sink := battle.aiTurns, battle.room.sink
+	time.AfterFunc(AI_DELAY, func() {
+		sink <- ClientEvent{nil, EVENT_BATTLE_AI, battle.TimerID(id)}
+	})
+}
+
+// Make the current NPC's move, unless the turn it was scheduled for is over.
+func (battle *Battle) PlayAI(id string) {
+	if battle.state != BATTLE_ACTIVE || battle.reaction != nil || battle.TimerID(battle.aiTurns) != id {
+		return
+	}
+	me := battle.Current()
+	if !me.IsAI() {
+		return
+	}
+	choice := battle.Choose(me, me.Leader().difficulty)
+	if choice == nil || battle.TakeTurn(me, choice.move, choice.group, choice.targets) != nil {
+		battle.Pass(me)
+	}
+}
+
+// Where NPCs' choices come from.
+func (battle *Battle) AIRand() *rand.Rand {
+	if battle.ai == nil {
+		battle.ai = rand.New(rand.NewSource(battle.dice.seed))
+	}
+	return battle.ai
+}
+
+// Pick a move for an NPC from everything they can use right now.
+func (battle *Battle) Choose(me *Combatant, difficulty int) *Choice {
+	choices := battle.Choices(me)
+	if len(choices) == 0 {
+		return nil
+	}
+	if battle.AIRand().Float64() >= greed[difficulty] {
+		return &choices[battle.AIRand().Intn(len(choices))]
+	}
+	var best []int
+	for i, choice := range choices {
+		switch {
+		case len(best) == 0 || choice.damage > choices[best[0]].damage:
+			best = []int{i}
+		case choice.damage == choices[best[0]].damage:
+			best = append(best, i)
+		}
+	}
+	return &choices[best[battle.AIRand().Intn(len(best))]]
+}
+
+// Every move a combatant could use on their turn, aimed at everybody it could
+// be aimed at. Cooldowns, limits and conditions are all respected.
+func (battle *Battle) Choices(me *Combatant) []Choice {
+	var choices []Choice
+	me.EachActive(func(move *Move, group *Group) {
+		if IsReactive(move, group) || !battle.Available(me, move, group) {
+			return
+		}
+		if group != nil && me.CanUse(group.Key(), group.Title(), group.limit) != nil {
+			return
+		}
+		if me.CanUse(move.name, move.Title(), move.limit) != nil {
+			return
+		}
+		for _, targets := range battle.TargetOptions(me, move) {
+			ctx := NewCommandContext(battle, me, me)
+			ctx.targets = targets
+			if move.target == TARGET_OPPONENT && len(targets) == 1 {
+				ctx.opponent = targets[0]
+			}
+			damage := ctx.ExpectedDamage(me.player.OnActivate(move), 1)
+			choices = append(choices, Choice{move, group, targets, damage})
+		}
+	})
+	return choices
+}
+
+// The different ways a move could be aimed: one for each combatant it could
+// be aimed at if the player picks, one for each team if it hits a team, or
+// just the one otherwise.
+func (battle *Battle) TargetOptions(me *Combatant, move *Move) [][]*Combatant {
+	var options [][]*Combatant
+	switch {
+	case IsChosenTarget(move.target):
+		for _, c := range battle.TargetCandidates(me, move.target) {
+			options = append(options, []*Combatant{c})
+		}
+	case move.target == TARGET_TEAM:
+		options = battle.OpposingTeams(me)
+	default:
+		if targets, err := battle.ChooseTargets(me, move, ""); err == nil {
+			options = append(options, targets)
+		}
+	}
+	return options
+}
+
+// Work out how much damage a tree of commands can be expected to do, given
+// the chance that it gets run at all. Rolls are weighed by how likely they
+// are to hit, and damage to our own side counts against it. While the
+// branches of a roll are worked out, {myRoll} and {enemyRoll} are what the
+// totals usually come to when it hits or misses.
+func (ctx *CommandContext) ExpectedDamage(commands []Command, chance float64) float64 {
+	total := 0.0
+	for _, command := range commands {
+		switch command.name {
+		case "roll":
+			odds := ctx.RollOdds(command.args)
+			total += ctx.expectedBranch(command.on_succeed, chance*odds.hit, odds.onHit)
+			total += ctx.expectedBranch(command.on_fail, chance*(1-odds.hit), odds.onMiss)
+			continue
+		case "attack":
+			total += chance * ctx.expectedAttack(command.args)
+		}
+		total += ctx.ExpectedDamage(command.on_succeed, chance)
+	}
+	return total
+}
+
+// The expected damage of one branch of a roll, with the totals it'd be run
+// with.
+func (ctx *CommandContext) expectedBranch(commands []Command, chance float64, totals [2]float64) float64 {
+	if len(commands) == 0 || chance == 0 {
+		return 0
+	}
+	myRoll, hadMine := ctx.vars["myRoll"]
+	enemyRoll, hadEnemy := ctx.vars["enemyRoll"]
+	ctx.vars["myRoll"], ctx.vars["enemyRoll"] = int(math.Round(totals[0])), int(math.Round(totals[1]))
+	total := ctx.ExpectedDamage(commands, chance)
+	delete(ctx.vars, "myRoll")
+	delete(ctx.vars, "enemyRoll")
+	if hadMine {
+		ctx.vars["myRoll"] = myRoll
+	}
+	if hadEnemy {
+		ctx.vars["enemyRoll"] = enemyRoll
+	}
+	return total
+}
+
+func (ctx *CommandContext) expectedAttack(args []string) float64 {
+	targets, err := ctx.Targets(args[0])
+	if err != nil {
+		return 0
+	}
+	damage, err := ctx.Number(args[1])
+	if err != nil {
+		return 0
+	}
+	damage += ctx.me.stats.attack
+	total := 0.0
+	for _, target := range targets {
+		dealt := damage
+		if dealt > target.hp {
+			dealt = target.hp
+		}
+		if dealt < 0 {
+			dealt = 0
+		}
+		if target.team == ctx.me.team {
+			total -= float64(dealt)
+		} else {
+			total += float64(dealt)
+		}
+	}
+	return total
+}
+
+type RollOdds struct { // How a roll command is likely to go.
+	hit    float64    // The chance that it meets or beats the opponent's defense.
+	onHit  [2]float64 // The average attack and defense totals when it hits.
+	onMiss [2]float64 // The average attack and defense totals when it misses.
+}
+
+// Work out how likely a roll command is to meet or beat the opponent's
+// defense, and what the totals usually are either way.
+func (ctx *CommandContext) RollOdds(args []string) RollOdds {
+	count, err := ctx.Number(args[0])
+	if err != nil {
+		return RollOdds{}
+	}
+	sides, err := ctx.Number(args[1])
+	if err != nil {
+		return RollOdds{}
+	}
+	modifier := 0
+	if len(args) > 2 {
+		if modifier, err = ctx.Number(args[2]); err != nil {
+			return RollOdds{}
+		}
+	}
+	opponents, err := ctx.lookupTargets("opponent")
+	if err != nil || count < 0 || count > MAX_DICE || sides < 1 || sides > MAX_SIDES {
+		return RollOdds{}
+	}
+	attack := diceOdds(count, sides)
+	modifier += ctx.me.stats.diceModAttack
+	stats := opponents[0].stats
+	defense := []float64{1}
+	defenseMod := stats.diceModDefense
+	if stats.diceType == DICE_FIXED {
+		defenseMod += stats.diceValue
+	} else {
+		defense = diceOdds(stats.diceAmount, stats.diceType)
+	}
+	// The chance that the defense comes to each total or less, and what those
+	// totals add up to, weighed by their chances.
+	below := make([]float64, len(defense))
+	belowSum := make([]float64, len(defense))
+	chance, sum := 0.0, 0.0
+	for total, p := range defense {
+		chance += p
+		sum += p * float64(total)
+		below[total], belowSum[total] = chance, sum
+	}
+	var hit, hitAttack, hitDefense, missAttack, missDefense float64
+	for total, p := range attack {
+		need := total + modifier - defenseMod
+		var hitChance, hitSum float64
+		switch {
+		case need >= len(below):
+			hitChance, hitSum = 1, sum
+		case need >= 0:
+			hitChance, hitSum = below[need], belowSum[need]
+		}
+		hit += p * hitChance
+		hitAttack += p * hitChance * float64(total+modifier)
+		hitDefense += p * hitSum
+		missAttack += p * (1 - hitChance) * float64(total+modifier)
+		missDefense += p * (sum - hitSum)
+	}
+	odds := RollOdds{hit: hit}
+	if hit > 0 {
+		odds.onHit = [2]float64{hitAttack / hit, hitDefense/hit + float64(defenseMod)}
+	}
+	if hit < 1 {
+		odds.onMiss = [2]float64{missAttack / (1 - hit), missDefense/(1-hit) + float64(defenseMod)}
+	}
+	return odds
+}
+
+// The chance of each total when throwing <count> dice with <sides> sides, by
+// total.
+func diceOdds(count, sides int) []float64 {
+	odds := []float64{1}
+	if sides < 1 {
+		return odds
+	}
+	for i := 0; i < count; i++ {
+		// Each new total is the average of the chances of the totals one to
+		// <sides> below it, which a running sum gives us without a loop per die.
+		next := make([]float64, len(odds)+sides)
+		window := 0.0
+		for total := 1; total < len(next); total++ {
+			if total-1 < len(odds) {
+				window += odds[total-1]
+			}
+			if total-1-sides >= 0 {
+				window -= odds[total-1-sides]
+			}
+			next[total] = window / float64(sides)
+		}
+		odds = next
+	}
+	return odds
+}
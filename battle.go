@@ -0,0 +1,699 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	BATTLE_PENDING = iota // A challenge was sent, but hasn't been accepted yet
+	BATTLE_ACTIVE  = iota // Combatants are taking turns
+	BATTLE_OVER    = iota // Somebody won, or everybody left
+)
+
+type Combatant struct { // A player character that is taking part in a battle.
+	name   string  // Name of the character, as it was picked.
+	player Player  // The character as it was when the battle started.
+	client *Client // The client controlling this combatant.
+	hp     int     // Their current HP.
+
+	base  Stats // Their stats as the character file gives them.
+	stats Stats // Their stats right now, after everything that's changed them.
+
+	moveStates map[string]*MoveState // Cooldowns and uses of their moves, by move name.
+	available  map[string]bool       // Which moves and groups they could see last time we checked.
+	owner      *Combatant            // Whoever summoned them; nil if nobody did.
+	team       int                   // Which side they're on. Bots are on the same side as whoever summoned them.
+	difficulty int                   // How well the server plays them, if they're an NPC; one of the AI_ constants.
+}
+
+type Battle struct { // A turn-based fight between clients in a room.
+	room       *Room           // The room the battle takes place in.
+	id         int             // Which of the room's battles this is, so timers left over from earlier ones are ignored.
+	state      int             // One of the BATTLE_ constants.
+	invited    map[*Client]int // Clients that still have to ACCEPT the challenge, and the team each of them is on.
+	combatants []*Combatant    // Everyone in the battle, in turn order.
+	turn       int             // Index into combatants of whose turn it is.
+	round      int             // How many times the turn order went all the way around.
+	maxRounds  int             // How many rounds the battle can go on for before time's up; 0 for no limit.
+	firstTeam  int             // Which team moves first.
+	dice       *Dice           // Where every roll in this battle comes from.
+	aiTurns    int             // How many times an NPC has been scheduled to move.
+	ai         *rand.Rand      // Where NPCs' choices come from. It's kept apart from the dice, so replays don't need it.
+
+	record    []ReplayEvent           // Everything that's happened in the battle so far, so it can be replayed.
+	replaying bool                    // Whether this is a replay, which only does what the record says.
+	replayID  string                  // What the record is called, once it's stored.
+	watch     func(msg string)        // Called with every message about the battle, if set.
+	observe   func(event ReplayEvent) // Called with everything that's recorded, if set.
+	winners   []*Combatant            // Who won, once it's over; nobody if it was a draw.
+
+	attacks   []*Attack       // Attacks that have been declared, but haven't landed yet.
+	reaction  *ReactionWindow // Set while combatants can react to those attacks.
+	reactions int             // How many reaction windows there have been.
+
+	effects []*Effect // Effects that are still going, in the order they started.
+}
+
+// Create a battle whose rolls all come from the given seed, so the same seed
+// and the same moves always play out the same way.
+func NewBattle(room *Room, invited map[*Client]int, seed int64) *Battle {
+	room.battles++
+	return &Battle{room: room, id: room.battles, state: BATTLE_PENDING, invited: invited, round: 1, maxRounds: room.MaxRounds, dice: NewDice(seed)}
+}
+
+// What a timer's event says it's for: the battle, and which of the battle's
+// reaction windows or NPC turns it belongs to.
+func (battle *Battle) TimerID(n int) string {
+	return fmt.Sprintf("%d.%d", battle.id, n)
+}
+
+// Add a client to the battle as the given character, on the given team.
+func (battle *Battle) Join(client *Client, character string, team int) (*Combatant, error) {
+	if battle.CombatantOf(client) != nil {
+		return nil, errors.New("You are already in this battle.")
+	}
+	player, found := GetPlayer(character)
+	if !found {
+		return nil, errors.New("There is no character named " + character)
+	}
+	if err := player.CheckControl(client); err != nil {
+		return nil, err
+	}
+	return battle.AddCombatant(player, client, team, 0), nil
+}
+
+// Put a character into the battle. Without a client, the server plays them.
+func (battle *Battle) AddCombatant(player Player, client *Client, team, difficulty int) *Combatant {
+	combatant := &Combatant{name: player.name, player: player, client: client, hp: player.hp, base: player.stats, stats: player.stats, team: team, difficulty: difficulty}
+	battle.combatants = append(battle.combatants, combatant)
+	return combatant
+}
+
+// The position of a combatant in the turn order, or -1 if they aren't in the
+// battle.
+func (battle *Battle) IndexOf(combatant *Combatant) int {
+	for i, c := range battle.combatants {
+		if c == combatant {
+			return i
+		}
+	}
+	return -1
+}
+
+// Find the combatant that a client is controlling, if any.
+func (battle *Battle) CombatantOf(client *Client) *Combatant {
+	for _, c := range battle.combatants {
+		if c.client == client {
+			return c
+		}
+	}
+	return nil
+}
+
+// The combatant whose turn it currently is.
+func (battle *Battle) Current() *Combatant {
+	return battle.combatants[battle.turn]
+}
+
+// Send a message about the battle to everybody in the room, and log it.
+func (battle *Battle) Announce(msg string) {
+	battle.room.Broadcast(msg)
+	battle.Log(msg)
+}
+
+// Like Announce, but the message is written differently for each client in the
+// room. What gets logged is the message as somebody outside the battle sees it.
+func (battle *Battle) AnnounceEach(msg func(viewer *Client) string) {
+	battle.room.BroadcastEach(msg)
+	battle.Log(msg(nil))
+}
+
+// Write a message to the room's log, and to whoever is watching a replay.
+func (battle *Battle) Log(msg string) {
+	if battle.watch != nil {
+		battle.watch(msg)
+	}
+	if battle.room.log_sink != nil {
+		battle.room.log_sink <- LogEvent{battle.room.name, "battle", msg, true}
+	}
+}
+
+func (battle *Battle) Start() {
+	battle.StartRecording()
+	battle.state = BATTLE_ACTIVE
+	battle.OrderTurns()
+	battle.Announce("The battle begins: " + battle.DescribeTeams())
+	if battle.room.log_sink != nil {
+		battle.room.log_sink <- LogEvent{battle.room.name, "battle", fmt.Sprintf("uses seed %d", battle.dice.seed), true}
+	}
+	for _, c := range battle.combatants {
+		battle.ActivatePassives(c)
+	}
+	battle.ResolveAttacks()
+	if battle.CheckWinner() {
+		return
+	}
+	battle.AnnounceTurn()
+}
+
+func (battle *Battle) AnnounceTurn() {
+	for _, c := range battle.combatants {
+		battle.NotifyAvailability(c)
+	}
+	current := battle.Current()
+	battle.Announce(fmt.Sprintf("Round %d: it's %s's turn.", battle.round, current))
+	battle.ScheduleAI()
+}
+
+// Use one of the current combatant's active moves, then end their turn. The
+// target is who the player picked to aim it at, if anybody.
+func (battle *Battle) UseMove(combatant *Combatant, name, target string) error {
+	if battle.Current() != combatant {
+		return errors.New("It isn't your turn.")
+	}
+	if battle.reaction != nil {
+		return errors.New("Wait for everybody to react first.")
+	}
+	move, group := combatant.FindActive(name)
+	if move == nil {
+		return errors.New(combatant.name + " has no move called " + name)
+	}
+	if IsReactive(move, group) {
+		return errors.New(move.Title() + " can only be used on somebody else's turn.")
+	}
+	targets, err := battle.ChooseTargets(combatant, move, target)
+	if err != nil {
+		return err
+	}
+	return battle.TakeTurn(combatant, move, group, targets)
+}
+
+// Play a move on a combatant's turn, once it's been picked and aimed, then
+// give everybody it attacks a chance to react.
+func (battle *Battle) TakeTurn(combatant *Combatant, move *Move, group *Group, targets []*Combatant) error {
+	if err := battle.PrepareMove(combatant, move, group); err != nil {
+		return err
+	}
+	battle.Record(battle.moveEvent("move", combatant, move, group, targets))
+	battle.PlayMove(combatant, move, targets)
+	battle.OpenReactions()
+	return nil
+}
+
+// Let the current combatant skip their turn.
+func (battle *Battle) Pass(combatant *Combatant) {
+	battle.Record(ReplayEvent{Event: "pass", Who: battle.IndexOf(combatant)})
+	battle.Announce(combatant.String() + " passes.")
+	battle.EndTurn()
+}
+
+// Check that a move can be used right now, and if so, start its cooldown.
+func (battle *Battle) PrepareMove(combatant *Combatant, move *Move, group *Group) error {
+	if !battle.Available(combatant, move, group) {
+		return errors.New(move.Title() + " isn't available right now.")
+	}
+	if group != nil {
+		if err := combatant.CanUse(group.Key(), group.Title(), group.limit); err != nil {
+			return err
+		}
+	}
+	if err := combatant.CanUse(move.name, move.Title(), move.limit); err != nil {
+		return err
+	}
+	if group != nil {
+		combatant.MarkUsed(group.Key(), group.cooldown)
+	}
+	combatant.MarkUsed(move.name, move.cooldown)
+	return nil
+}
+
+// Announce a move and run its on_activate commands against its targets.
+func (battle *Battle) PlayMove(combatant *Combatant, move *Move, targets []*Combatant) {
+	battle.AnnounceEach(func(viewer *Client) string {
+		msg := fmt.Sprintf("%s used %s!", combatant, move.Title())
+		if IsChosenTarget(move.target) && len(targets) == 1 {
+			msg = fmt.Sprintf("%s used %s on %s!", combatant, move.Title(), targets[0])
+		}
+		if move.target == TARGET_TEAM {
+			msg = fmt.Sprintf("%s used %s on %s!", combatant, move.Title(), describeTeam(targets))
+		}
+		if bio := move.Bio(combatant.name, viewer != nil && combatant.Controller() == viewer); bio != "" {
+			msg += " " + bio
+		}
+		return msg
+	})
+	ctx := NewCommandContext(battle, combatant, combatant)
+	ctx.move = move
+	ctx.targets = targets
+	if move.target == TARGET_OPPONENT && len(targets) == 1 {
+		ctx.opponent = targets[0]
+	}
+	if move.Lasts() {
+		battle.ApplyEffect(ctx, move)
+		return
+	}
+	err := ctx.Run(combatant.player.OnActivate(move))
+	if err != nil {
+		battle.Announce(fmt.Sprintf("%s fizzled: %s", move.Title(), err.Error()))
+	}
+}
+
+// Start the effects of everything that's active from the start.
+func (battle *Battle) ActivatePassives(combatant *Combatant) {
+	for _, moves := range []*[]Move{combatant.player.passives, combatant.player.optionalPassives} {
+		if moves == nil {
+			continue
+		}
+		for i := range *moves {
+			battle.ApplyEffect(NewCommandContext(battle, combatant, combatant), &(*moves)[i])
+		}
+	}
+}
+
+// Deal damage from one combatant to another.
+func (battle *Battle) Damage(attacker, target *Combatant, damage int) {
+	if target.hp <= 0 {
+		return
+	}
+	target.hp -= damage
+	battle.Announce(fmt.Sprintf("%s hit %s for %d damage.", attacker, target, damage))
+	if target.hp <= 0 {
+		battle.Defeat(target, fmt.Sprintf("%s was defeated!", target))
+	}
+}
+
+// Take a combatant out of the fight, undoing their effects and any that are on
+// them. Anything they summoned goes with them.
+func (battle *Battle) Defeat(combatant *Combatant, msg string) {
+	combatant.hp = 0
+	battle.Announce(msg)
+	battle.RemoveEffects(combatant)
+	for _, c := range battle.combatants {
+		if c.owner == combatant && c.hp > 0 {
+			battle.Defeat(c, fmt.Sprintf("%s disappears along with %s.", c, combatant.name))
+		}
+	}
+}
+
+// Bring a bot into the battle on the side of whoever summoned it. It goes
+// right after its owner in the turn order.
+func (battle *Battle) Summon(owner *Combatant, player Player) *Combatant {
+	bot := &Combatant{name: player.name, player: player, hp: player.hp, owner: owner, base: player.stats, stats: player.stats, team: owner.team}
+	pos := len(battle.combatants)
+	for i, c := range battle.combatants {
+		if c == owner {
+			pos = i + 1
+		}
+	}
+	battle.combatants = append(battle.combatants, nil)
+	copy(battle.combatants[pos+1:], battle.combatants[pos:])
+	battle.combatants[pos] = bot
+	if pos <= battle.turn {
+		battle.turn++
+	}
+	battle.Announce(fmt.Sprintf("%s summoned %s with %d HP.", owner, bot, bot.hp))
+	battle.ActivatePassives(bot)
+	return bot
+}
+
+// The first opponent of the given combatant that is still standing.
+func (battle *Battle) OpponentOf(combatant *Combatant) *Combatant {
+	opponents := battle.Opponents(combatant)
+	if len(opponents) == 0 {
+		return nil
+	}
+	return opponents[0]
+}
+
+// Everybody still standing on the same side as the combatant, including them.
+func (battle *Battle) Allies(combatant *Combatant) []*Combatant {
+	var allies []*Combatant
+	for _, c := range battle.combatants {
+		if c.hp > 0 && c.team == combatant.team {
+			allies = append(allies, c)
+		}
+	}
+	return allies
+}
+
+// Everybody still standing on a different side than the combatant.
+func (battle *Battle) Opponents(combatant *Combatant) []*Combatant {
+	var opponents []*Combatant
+	for _, c := range battle.combatants {
+		if c.hp > 0 && c.team != combatant.team {
+			opponents = append(opponents, c)
+		}
+	}
+	return opponents
+}
+
+// Pass the turn on to the next combatant that is still standing.
+func (battle *Battle) EndTurn() {
+	battle.ResolveAttacks()
+	if battle.CheckWinner() {
+		return
+	}
+	battle.Current().TickCooldowns()
+	battle.TickEffects(battle.Current(), EXPIRE_END)
+	for {
+		battle.turn++
+		if battle.turn >= len(battle.combatants) {
+			battle.turn = 0
+			battle.round++
+		}
+		if battle.Current().hp > 0 && battle.Current().TakesTurns() {
+			break
+		}
+	}
+	if battle.maxRounds > 0 && battle.round > battle.maxRounds {
+		battle.TimeUp()
+		return
+	}
+	battle.TickEffects(battle.Current(), EXPIRE_START)
+	// Effects wearing off can defeat somebody, even whoever's turn it is.
+	if battle.CheckWinner() {
+		return
+	}
+	if battle.Current().hp <= 0 {
+		battle.EndTurn()
+		return
+	}
+	battle.AnnounceTurn()
+}
+
+// End the battle if there's only one team left standing.
+func (battle *Battle) CheckWinner() bool {
+	standing := battle.StandingTeams()
+	switch len(standing) {
+	case 0:
+		battle.End("Nobody is left standing; the battle is a draw.")
+	case 1:
+		battle.Win(standing[0])
+	}
+	return battle.state == BATTLE_OVER
+}
+
+// Take a combatant out of the battle, because they gave up or left the room.
+func (battle *Battle) Forfeit(combatant *Combatant) {
+	battle.Record(ReplayEvent{Event: "forfeit", Who: battle.IndexOf(combatant)})
+	battle.Defeat(combatant, fmt.Sprintf("%s forfeits.", combatant))
+	if battle.CheckWinner() {
+		return
+	}
+	if !battle.HasPlayers() {
+		battle.End("Nobody is left to play, so the battle is over.")
+		return
+	}
+	if battle.reaction != nil {
+		for c := range battle.reaction.waiting {
+			if c.hp <= 0 {
+				battle.DoneReacting(c)
+			}
+		}
+		return
+	}
+	if battle.Current().hp <= 0 {
+		battle.EndTurn()
+	}
+}
+
+// Called when a client leaves the room that the battle is in.
+func (room *Room) LeaveBattle(client *Client) {
+	battle := room.battle
+	if battle == nil {
+		return
+	}
+	combatant := battle.CombatantOf(client)
+	switch {
+	case battle.state == BATTLE_PENDING && (combatant != nil || battle.IsInvited(client)):
+		room.battle = nil
+		battle.Announce(client.nickname + " left, so the battle was called off.")
+	case battle.state == BATTLE_ACTIVE && combatant != nil && combatant.hp > 0:
+		battle.Forfeit(combatant)
+		if battle.state == BATTLE_OVER {
+			room.battle = nil
+		}
+	}
+}
+
+// The combatant at the top of the chain of whoever summoned whom.
+func (combatant *Combatant) Leader() *Combatant {
+	for combatant.owner != nil {
+		combatant = combatant.owner
+	}
+	return combatant
+}
+
+// Call a function for each of the combatant's actives, along with the group
+// it's in if it's in one.
+func (combatant *Combatant) EachActive(fn func(move *Move, group *Group)) {
+	if combatant.player.actives != nil {
+		for i := range *combatant.player.actives {
+			fn(&(*combatant.player.actives)[i], nil)
+		}
+	}
+	if combatant.player.groups != nil {
+		for i := range *combatant.player.groups {
+			group := &(*combatant.player.groups)[i]
+			for j := range group.moves {
+				fn(&group.moves[j], group)
+			}
+		}
+	}
+}
+
+// The client that gets to pick moves for this combatant. Bots are controlled
+// by whoever summoned them.
+func (combatant *Combatant) Controller() *Client {
+	return combatant.Leader().client
+}
+
+// Bots that have no actives of their own only act through their passives, so
+// they're skipped in the turn order.
+func (combatant *Combatant) TakesTurns() bool {
+	if combatant.owner == nil {
+		return true
+	}
+	return combatant.player.actives != nil || combatant.player.groups != nil
+}
+
+func (combatant *Combatant) String() string {
+	controller := combatant.Controller()
+	if controller == nil && combatant.owner == nil {
+		return combatant.name + " (NPC)"
+	}
+	if controller == nil {
+		return combatant.name
+	}
+	return fmt.Sprintf("%s (%s)", combatant.name, controller.nickname)
+}
+
+// Find one of the combatant's active moves by its internal or pretty name,
+// along with the group it's in if it's in one.
+func (combatant *Combatant) FindActive(name string) (*Move, *Group) {
+	var found *Move
+	var foundGroup *Group
+	combatant.EachActive(func(move *Move, group *Group) {
+		if found == nil && (strings.EqualFold(move.name, name) || strings.EqualFold(move.prettyName, name)) {
+			found, foundGroup = move, group
+		}
+	})
+	return found, foundGroup
+}
+
+// Tell the client controlling a combatant about one of their moves.
+func (combatant *Combatant) ReplyMove(client *Client, move Move, indent string) {
+	client.ReplyNicknamed(indent+move.name, move.Title(), "("+combatant.DescribeUsage(move.name, move.limit)+", "+targetDescriptions[move.target]+")", move.Bio(combatant.name, true))
+	if move.instruction != "" {
+		client.ReplyNicknamed(indent+move.name, move.Instruction(combatant.name, true))
+	}
+}
+
+// The key that a group's cooldown and uses are tracked under, so it can't
+// clash with a move of the same name.
+func (group *Group) Key() string {
+	return "group:" + group.name
+}
+
+// Battle commands are routed here from the daemon, so that everything that
+// touches a battle happens on the room's goroutine.
+func (room *Room) HandlerBattle(client *Client, text string) {
+	cols := strings.Fields(text)
+	if len(cols) == 0 {
+		return
+	}
+	command := strings.ToUpper(cols[0])
+	args := cols[1:]
+	battle := room.battle
+	var combatant *Combatant
+	if battle != nil {
+		combatant = battle.CombatantOf(client)
+		// On the turn of a bot that the client summoned, they're playing as it.
+		if combatant != nil && battle.state == BATTLE_ACTIVE && battle.Current().Controller() == client {
+			combatant = battle.Current()
+		}
+	}
+
+	switch command {
+	case "CHALLENGE":
+		if len(args) < 2 {
+			client.ReplyNotEnoughParameters("CHALLENGE")
+			return
+		}
+		if battle != nil {
+			client.ReplyNicknamed("There's already a battle going on in " + room.name)
+			return
+		}
+		invited, npcs, err := room.InviteTeams(client, ParseTeams(args[0]))
+		if err != nil {
+			client.ReplyNicknamed(err.Error())
+			return
+		}
+		battle = NewBattle(room, invited, time.Now().UnixNano())
+		_, err = battle.Join(client, strings.Join(args[1:], " "), 0)
+		if err != nil {
+			client.ReplyNicknamed(err.Error())
+			return
+		}
+		challenged := battle.Waiting()
+		for _, npc := range npcs {
+			joined, err := battle.JoinNPC(npc.character, npc.team, npc.difficulty)
+			if err != nil {
+				client.ReplyNicknamed(err.Error())
+				return
+			}
+			challenged = append(challenged, joined.String())
+		}
+		room.battle = battle
+		msg := fmt.Sprintf("%s challenged %s to a battle as %s!", client.nickname, strings.Join(challenged, ", "), battle.combatants[0].name)
+		if len(invited) > 0 {
+			msg += " Use ACCEPT <character> or DECLINE."
+		}
+		battle.Announce(msg)
+		if len(invited)+len(npcs) > 1 {
+			battle.Announce("Teams: " + DescribeChallenge(client, invited, npcs))
+		}
+		// A challenge against nobody but NPCs starts straight away.
+		if len(invited) == 0 {
+			battle.Start()
+		}
+	case "ACCEPT":
+		if len(args) < 1 {
+			client.ReplyNotEnoughParameters("ACCEPT")
+			return
+		}
+		if battle == nil || battle.state != BATTLE_PENDING || !battle.IsInvited(client) {
+			client.ReplyNicknamed("Nobody has challenged you.")
+			return
+		}
+		joined, err := battle.Join(client, strings.Join(args, " "), battle.invited[client])
+		if err != nil {
+			client.ReplyNicknamed(err.Error())
+			return
+		}
+		delete(battle.invited, client)
+		if len(battle.invited) > 0 {
+			battle.Announce(fmt.Sprintf("%s is in as %s. Still waiting for %s.", client.nickname, joined.name, strings.Join(battle.Waiting(), ", ")))
+			return
+		}
+		battle.Start()
+	case "DECLINE":
+		if battle == nil || battle.state != BATTLE_PENDING || (!battle.IsInvited(client) && combatant == nil) {
+			client.ReplyNicknamed("Nobody has challenged you.")
+			return
+		}
+		room.battle = nil
+		battle.Announce(client.nickname + " called off the battle.")
+	case "MOVE":
+		if combatant == nil || battle.state != BATTLE_ACTIVE {
+			client.ReplyNicknamed("You aren't in a battle.")
+			return
+		}
+		if len(args) < 1 {
+			client.ReplyNotEnoughParameters("MOVE")
+			return
+		}
+		var err error
+		if reactor := battle.Reactor(client); reactor != nil {
+			name, target := SplitMoveArgs(reactor, args)
+			err = battle.UseReaction(reactor, name, target)
+		} else {
+			name, target := SplitMoveArgs(combatant, args)
+			err = battle.UseMove(combatant, name, target)
+		}
+		if err != nil {
+			client.ReplyNicknamed(err.Error())
+		}
+	case "PASS":
+		if combatant == nil || battle.state != BATTLE_ACTIVE {
+			client.ReplyNicknamed("You aren't in a battle.")
+			return
+		}
+		if reactor := battle.Reactor(client); reactor != nil {
+			battle.SkipReaction(reactor)
+			return
+		}
+		if battle.Current() != combatant {
+			client.ReplyNicknamed("It isn't your turn.")
+			return
+		}
+		if battle.reaction != nil {
+			client.ReplyNicknamed("Wait for everybody to react first.")
+			return
+		}
+		battle.Pass(combatant)
+	case "FORFEIT":
+		if combatant == nil || battle.state != BATTLE_ACTIVE {
+			client.ReplyNicknamed("You aren't in a battle.")
+			return
+		}
+		battle.Forfeit(combatant.Leader())
+	case "MOVES":
+		if combatant == nil {
+			client.ReplyNicknamed("You aren't in a battle.")
+			return
+		}
+		shown := 0
+		var lastGroup *Group
+		combatant.EachActive(func(move *Move, group *Group) {
+			if !battle.Available(combatant, move, group) {
+				return
+			}
+			indent := ""
+			if group != nil {
+				if group != lastGroup {
+					client.ReplyNicknamed(group.name, group.Title(), "(group, "+combatant.DescribeUsage(group.Key(), group.limit)+")", group.Bio(combatant.name, true))
+					lastGroup = group
+				}
+				indent = "  "
+			}
+			combatant.ReplyMove(client, *move, indent)
+			shown++
+		})
+		if shown == 0 {
+			client.ReplyNicknamed(combatant.name + " has no moves available right now.")
+		}
+	case "STATUS":
+		if battle == nil {
+			client.ReplyNicknamed("There's no battle going on in " + room.name)
+			return
+		}
+		for _, c := range battle.combatants {
+			client.ReplyNicknamed(c.String(), fmt.Sprintf("%d HP", c.hp), c.DescribeStats())
+			if effects := battle.DescribeEffects(c); effects != "" {
+				client.ReplyNicknamed(c.String(), "Effects: "+effects)
+			}
+		}
+		if battle.state == BATTLE_ACTIVE {
+			client.ReplyNicknamed("Teams: " + battle.DescribeTeams())
+			client.ReplyNicknamed(fmt.Sprintf("Round %d, %s's turn", battle.round, battle.Current()))
+		}
+	}
+	if room.battle != nil && room.battle.state == BATTLE_OVER {
+		room.battle = nil
+	}
+}
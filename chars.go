@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	PAGE_LINES = 15 // How many lines of CHARS or CHARINFO are sent at a time.
+)
+
+// Every loaded character, sorted by name.
+func ListPlayers() []Player {
+	playersLock.RLock()
+	defer playersLock.RUnlock()
+	players := make([]Player, 0, len(recognizedPlayers))
+	for _, player := range recognizedPlayers {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return strings.ToLower(players[i].name) < strings.ToLower(players[j].name)
+	})
+	return players
+}
+
+// Send one page of a long listing. The command is what the client should send
+// to get the next page, without the page number.
+func ReplyPage(client *Client, lines []string, page int, command string) {
+	pages := (len(lines) + PAGE_LINES - 1) / PAGE_LINES
+	if pages == 0 {
+		pages = 1
+	}
+	if page < 1 || page > pages {
+		client.ReplyNicknamed(fmt.Sprintf("There's no page %d; pick one from 1 to %d.", page, pages))
+		return
+	}
+	start := (page - 1) * PAGE_LINES
+	end := start + PAGE_LINES
+	if end > len(lines) {
+		end = len(lines)
+	}
+	for _, line := range lines[start:end] {
+		client.ReplyNicknamed(line)
+	}
+	if pages > 1 {
+		msg := fmt.Sprintf("Page %d of %d.", page, pages)
+		if page < pages {
+			msg += fmt.Sprintf(" Use %s %d for the next one.", command, page+1)
+		}
+		client.ReplyNicknamed(msg)
+	}
+}
+
+// Split a trailing page number off a command's arguments.
+func splitPage(args []string) ([]string, int) {
+	if len(args) > 0 {
+		if page, err := strconv.Atoi(args[len(args)-1]); err == nil {
+			return args[:len(args)-1], page
+		}
+	}
+	return args, 1
+}
+
+// CHARS [page]
+func (daemon *Daemon) HandlerChars(client *Client, cols []string) {
+	var args []string
+	if len(cols) > 1 {
+		args = strings.Fields(cols[1])
+	}
+	_, page := splitPage(args)
+	players := ListPlayers()
+	if len(players) == 0 {
+		client.ReplyNicknamed("There are no characters loaded.")
+		return
+	}
+	lines := []string{}
+	for _, player := range players {
+		line := fmt.Sprintf("%s: owned by %s, %d HP", player.name, player.owner, player.hp)
+		if player.aggressive {
+			line += ", aggressive"
+		}
+		if player.owner_conn != nil {
+			line += ", claimed by " + player.owner_conn.nickname
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "Use CHARINFO <character> to see their moves.")
+	ReplyPage(client, lines, page, "CHARS")
+}
+
+// CHARINFO <character> [page]
+func (daemon *Daemon) HandlerCharInfo(client *Client, cols []string) {
+	var args []string
+	if len(cols) > 1 {
+		args = strings.Fields(cols[1])
+	}
+	if len(args) == 0 {
+		client.ReplyNotEnoughParameters("CHARINFO")
+		return
+	}
+	name := strings.Join(args, " ")
+	player, found := GetPlayer(name)
+	page := 1
+	if !found {
+		args, page = splitPage(args)
+		name = strings.Join(args, " ")
+		player, found = GetPlayer(name)
+	}
+	if !found {
+		client.ReplyNicknamed("There is no character named " + name)
+		return
+	}
+	ReplyPage(client, player.Describe(player.ClaimableBy(client)), page, "CHARINFO "+name)
+}
+
+// Describe a character and all of their moves, a line at a time. Whoever can
+// play as the character reads their bios in the second person.
+func (player Player) Describe(viewerIsOwner bool) []string {
+	summary := fmt.Sprintf("%s: owned by %s, %d HP", player.name, player.owner, player.hp)
+	if player.aggressive {
+		summary += ", aggressive"
+	}
+	lines := []string{summary}
+	if player.bio != "" {
+		lines = append(lines, RenderText(player.bio, player.name, viewerIsOwner))
+	}
+	lines = append(lines, "Stats: "+player.stats.Describe())
+
+	tables := []struct {
+		title string
+		moves *[]Move
+	}{
+		{"Passives", player.passives},
+		{"Optional passives", player.optionalPassives},
+		{"Actives", player.actives},
+	}
+	for _, table := range tables {
+		if table.moves == nil {
+			continue
+		}
+		lines = append(lines, table.title+":")
+		for _, move := range *table.moves {
+			lines = append(lines, player.describeMove(move, "  ", viewerIsOwner, table.title == "Actives")...)
+		}
+	}
+	if player.groups != nil {
+		lines = append(lines, "Groups:")
+		for _, group := range *player.groups {
+			line := "  " + describeTitle(group.name, group.prettyName)
+			if rules := describeRules(group.cooldown, group.limit, group.reactive, group.prereq); rules != "" {
+				line += " (" + rules + ")"
+			}
+			if bio := group.Bio(player.name, viewerIsOwner); bio != "" {
+				line += ": " + bio
+			}
+			lines = append(lines, line)
+			if group.prereq_string != "" {
+				lines = append(lines, "    Needs: "+group.prereq_string)
+			}
+			for _, move := range group.moves {
+				lines = append(lines, player.describeMove(move, "    ", viewerIsOwner, true)...)
+			}
+		}
+	}
+	return lines
+}
+
+func (player Player) describeMove(move Move, indent string, viewerIsOwner, active bool) []string {
+	line := indent + describeTitle(move.name, move.prettyName)
+	rules := describeRules(move.cooldown, move.limit, move.reactive, move.prereq)
+	if active {
+		if rules != "" {
+			rules += ", "
+		}
+		rules += targetDescriptions[move.target]
+	}
+	if move.repeat != "" {
+		if rules != "" {
+			rules += ", "
+		}
+		rules += "repeats " + move.repeat
+	}
+	if lasting := describeLasting(move); lasting != "" {
+		if rules != "" {
+			rules += ", "
+		}
+		rules += lasting
+	}
+	if rules != "" {
+		line += " (" + rules + ")"
+	}
+	if bio := move.Bio(player.name, viewerIsOwner); bio != "" {
+		line += ": " + bio
+	}
+	lines := []string{line}
+	if instruction := move.Instruction(player.name, viewerIsOwner); instruction != "" {
+		lines = append(lines, indent+"  "+instruction)
+	}
+	return lines
+}
+
+// Something like "Blaster Beams [blaster]", or just "dodge".
+func describeTitle(name, prettyName string) string {
+	if prettyName == "" || prettyName == name {
+		return name
+	}
+	return prettyName + " [" + name + "]"
+}
+
+// Something like "cooldown 4 turns, 3 uses, reactive, needs passive_is_active booster".
+func describeRules(cooldown, limit int16, reactive bool, prereq []Condition) string {
+	rules := []string{}
+	if cooldown > 0 {
+		rules = append(rules, fmt.Sprintf("cooldown %d %s", cooldown, plural(int(cooldown), "turn", "turns")))
+	}
+	if limit > 0 {
+		rules = append(rules, fmt.Sprintf("%d %s", limit, plural(int(limit), "use", "uses")))
+	}
+	if reactive {
+		rules = append(rules, "reactive")
+	}
+	for _, condition := range prereq {
+		rules = append(rules, strings.TrimSpace("needs "+condition.meets+" "+condition.name))
+	}
+	return strings.Join(rules, ", ")
+}
+
+// Something like "lasts 3 turns, stacks, until hp_below 10".
+func describeLasting(move Move) string {
+	parts := []string{}
+	if move.duration > 0 {
+		lasts := fmt.Sprintf("lasts %d %s", move.duration, plural(int(move.duration), "turn", "turns"))
+		if move.expires == EXPIRE_START {
+			lasts += ", counted at the start of a turn"
+		}
+		parts = append(parts, lasts)
+	}
+	if move.stacks {
+		parts = append(parts, "stacks")
+	}
+	for _, condition := range move.until {
+		parts = append(parts, strings.TrimSpace("until "+condition.meets+" "+condition.name))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Something like "defense 1d20, attack rolls -5".
+func (stats Stats) Describe() string {
+	defense := fmt.Sprintf("defense %dd%d", stats.diceAmount, stats.diceType)
+	if stats.diceType == DICE_FIXED {
+		defense = fmt.Sprintf("defense always %d", stats.diceValue)
+	}
+	parts := []string{defense}
+	if stats.diceModDefense != 0 {
+		parts[0] += fmt.Sprintf("%+d", stats.diceModDefense)
+	}
+	if stats.diceModAttack != 0 {
+		parts = append(parts, fmt.Sprintf("attack rolls %+d", stats.diceModAttack))
+	}
+	if stats.attack != 0 {
+		parts = append(parts, fmt.Sprintf("damage %+d", stats.attack))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -86,6 +86,10 @@ func (client *Client) Processor(sink chan<- ClientEvent) {
 
 // Send message as is with CRLF appended.
 func (client *Client) Msg(text string) {
+	if client.conn == nil {
+		// Only stands in for somebody in a replay
+		return
+	}
 	client.conn.Write([]byte(text + CRLF))
 }
 
@@ -101,7 +105,6 @@ func (client *Client) ReplyParts(text ...string) {
 	for _, t := range text {
 		parts = append(parts, t)
 	}
-	parts[len(parts)-1] = parts[len(parts)-1]
 	client.Reply(strings.Join(parts, " "))
 }
 
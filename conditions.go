@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Checks whether a condition holds for a combatant. The arg is the condition's
+// name, which each check reads differently (a move name, a number, ...).
+type ConditionCheck func(battle *Battle, me *Combatant, arg string) (bool, error)
+
+var recognizedConditions map[string]ConditionCheck
+
+func init() {
+	recognizedConditions = map[string]ConditionCheck{
+		"passive_is_active": CondPassiveIsActive,
+		"hp_below":          CondHPBelow,
+		"hp_at_least":       CondHPAtLeast,
+		"turn_at_least":     CondTurnAtLeast,
+		"turn_below":        CondTurnBelow,
+		"bot_alive":         CondBotAlive,
+		"ally_alive":        CondAllyAlive,
+		"opponent_alive":    CondOpponentAlive,
+		"opponent_hp_below": CondOpponentHPBelow,
+	}
+}
+
+// Find the check for a condition. Any condition can be negated by putting
+// "not_" in front of it, like "not_bot_alive".
+func lookupCondition(meets string) (ConditionCheck, bool, error) {
+	negate := false
+	if strings.HasPrefix(meets, "not_") {
+		negate = true
+		meets = strings.TrimPrefix(meets, "not_")
+	}
+	check, found := recognizedConditions[meets]
+	if !found {
+		return nil, false, errors.New("Unknown condition: " + meets)
+	}
+	return check, negate, nil
+}
+
+// Check that every condition is one we know how to evaluate.
+func ValidateConditions(conditions []Condition) error {
+	for _, condition := range conditions {
+		if _, _, err := lookupCondition(condition.meets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Whether all of the given conditions hold for a combatant right now.
+func (battle *Battle) Meets(me *Combatant, conditions []Condition) (bool, error) {
+	for _, condition := range conditions {
+		check, negate, err := lookupCondition(condition.meets)
+		if err != nil {
+			return false, err
+		}
+		ok, err := check(battle, me, condition.name)
+		if err != nil {
+			return false, errors.New(condition.meets + ": " + err.Error())
+		}
+		if ok == negate {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Whether the move (and the group it's in, if any) can be seen by its owner
+// right now. A condition that can't be evaluated hides the move.
+func (battle *Battle) Available(me *Combatant, move *Move, group *Group) bool {
+	if group != nil {
+		if ok, _ := battle.Meets(me, group.prereq); !ok {
+			return false
+		}
+	}
+	ok, _ := battle.Meets(me, move.prereq)
+	return ok
+}
+
+// Tell a combatant's client about moves that appeared or disappeared since the
+// last time we checked.
+func (battle *Battle) NotifyAvailability(combatant *Combatant) {
+	if combatant.available == nil {
+		combatant.available = make(map[string]bool)
+	}
+	combatant.EachActive(func(move *Move, group *Group) {
+		key, title := move.name, move.Title()
+		if group != nil {
+			key, title = group.Key(), group.Title()
+		}
+		available := battle.Available(combatant, move, group)
+		was, seen := combatant.available[key]
+		if seen && was == available {
+			return
+		}
+		combatant.available[key] = available
+		if !seen || combatant.client == nil {
+			return
+		}
+		if available {
+			combatant.client.ReplyNicknamed(title + " is now available.")
+		} else {
+			combatant.client.ReplyNicknamed(title + " is no longer available.")
+		}
+	})
+}
+
+func parseThreshold(arg string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a number", arg)
+	}
+	return n, nil
+}
+
+// passive_is_active <passive>: the combatant or one of their allies started an
+// effect with that name, like a passive, and it hasn't worn off yet.
+func CondPassiveIsActive(battle *Battle, me *Combatant, arg string) (bool, error) {
+	for _, c := range battle.Allies(me) {
+		if battle.HasEffect(c, arg) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hp_below <n>
+func CondHPBelow(battle *Battle, me *Combatant, arg string) (bool, error) {
+	n, err := parseThreshold(arg)
+	return me.hp < n, err
+}
+
+// hp_at_least <n>
+func CondHPAtLeast(battle *Battle, me *Combatant, arg string) (bool, error) {
+	n, err := parseThreshold(arg)
+	return me.hp >= n, err
+}
+
+// turn_at_least <round>
+func CondTurnAtLeast(battle *Battle, me *Combatant, arg string) (bool, error) {
+	n, err := parseThreshold(arg)
+	return battle.round >= n, err
+}
+
+// turn_below <round>
+func CondTurnBelow(battle *Battle, me *Combatant, arg string) (bool, error) {
+	n, err := parseThreshold(arg)
+	return battle.round < n, err
+}
+
+// bot_alive [character]: a bot the combatant summoned is still standing.
+func CondBotAlive(battle *Battle, me *Combatant, arg string) (bool, error) {
+	for _, c := range battle.combatants {
+		if c.owner == me && c.hp > 0 && (arg == "" || strings.EqualFold(c.name, arg)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ally_alive [character]: somebody on the combatant's side, besides them, is
+// still standing.
+func CondAllyAlive(battle *Battle, me *Combatant, arg string) (bool, error) {
+	for _, c := range battle.Allies(me) {
+		if c != me && (arg == "" || strings.EqualFold(c.name, arg)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// opponent_alive [character]
+func CondOpponentAlive(battle *Battle, me *Combatant, arg string) (bool, error) {
+	for _, c := range battle.Opponents(me) {
+		if arg == "" || strings.EqualFold(c.name, arg) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// opponent_hp_below <n>: any opponent that's still standing has less HP than n.
+func CondOpponentHPBelow(battle *Battle, me *Combatant, arg string) (bool, error) {
+	n, err := parseThreshold(arg)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range battle.Opponents(me) {
+		if c.hp < n {
+			return true, nil
+		}
+	}
+	return false, nil
+}
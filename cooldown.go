@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+)
+
+const MAX_COUNT = 32767 // The most a cooldown, limit or duration can be, since they're kept as int16s.
+
+type MoveState struct { // How much a combatant has used one of their moves this battle.
+	cooldown int  // How many of their turns are left before it can be used again.
+	uses     int  // How many times it's been used.
+	justUsed bool // Whether it was used this turn, so the cooldown doesn't tick yet.
+}
+
+// Get the state of one of the combatant's moves, keyed by its name.
+func (combatant *Combatant) MoveState(key string) *MoveState {
+	if combatant.moveStates == nil {
+		combatant.moveStates = make(map[string]*MoveState)
+	}
+	state, found := combatant.moveStates[key]
+	if !found {
+		state = &MoveState{}
+		combatant.moveStates[key] = state
+	}
+	return state
+}
+
+// Check whether a move with the given cooldown and limit can be used right now.
+func (combatant *Combatant) CanUse(key, prettyName string, limit int16) error {
+	state := combatant.MoveState(key)
+	if state.cooldown > 0 {
+		return fmt.Errorf("%s is cooling down for %d more %s.", prettyName, state.cooldown, plural(state.cooldown, "turn", "turns"))
+	}
+	if limit > 0 && state.uses >= int(limit) {
+		return fmt.Errorf("%s has been used up; it can only be used %d %s per battle.", prettyName, limit, plural(int(limit), "time", "times"))
+	}
+	return nil
+}
+
+// Mark a move as used, starting its cooldown.
+func (combatant *Combatant) MarkUsed(key string, cooldown int16) {
+	state := combatant.MoveState(key)
+	state.uses++
+	state.cooldown = int(cooldown)
+	state.justUsed = true
+}
+
+// Count down the cooldowns on the combatant's moves once their turn is over.
+func (combatant *Combatant) TickCooldowns() {
+	for _, state := range combatant.moveStates {
+		if state.justUsed {
+			state.justUsed = false
+		} else if state.cooldown > 0 {
+			state.cooldown--
+		}
+	}
+}
+
+// Describe the cooldown and uses left on a move, like "ready, 2/3 uses left".
+func (combatant *Combatant) DescribeUsage(key string, limit int16) string {
+	state := combatant.MoveState(key)
+	msg := "ready"
+	if state.cooldown > 0 {
+		msg = fmt.Sprintf("cooling down for %d %s", state.cooldown, plural(state.cooldown, "turn", "turns"))
+	}
+	if limit > 0 {
+		msg += fmt.Sprintf(", %d/%d uses left", int(limit)-state.uses, limit)
+	}
+	return msg
+}
+
+// Check that a cooldown or limit read from a character file makes sense.
+func ValidateUsage(name string, cooldown, limit int) error {
+	if err := CheckCount("cooldown", name, cooldown); err != nil {
+		return err
+	}
+	return CheckCount("limit", name, limit)
+}
+
+// Check a cooldown, limit or duration read from a character file, for the
+// move or group with the given name if it's known.
+func CheckCount(key, name string, n int) error {
+	if n >= 0 && n <= MAX_COUNT {
+		return nil
+	}
+	if name == "" {
+		return fmt.Errorf("The %s has to be between 0 and %d, not %d", key, MAX_COUNT, n)
+	}
+	return fmt.Errorf("The %s for %s has to be between 0 and %d, not %d", key, name, MAX_COUNT, n)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
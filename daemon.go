@@ -19,6 +19,7 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -41,6 +42,8 @@ var (
 
 type Daemon struct {
 	Verbose              bool
+	MaxRounds            int
+	Difficulty           int
 	hostname             string
 	motd                 string
 	clients              map[*Client]bool
@@ -49,6 +52,11 @@ type Daemon struct {
 	last_aliveness_check time.Time
 	log_sink             chan<- LogEvent
 	state_sink           chan<- StateEvent
+	player_dir           string
+	log_dir              string
+	upload_dir           string
+	admins               map[string]bool
+	uploads              map[*Client]*bytes.Buffer
 }
 
 func NewDaemon(hostname, motd string, log_sink chan<- LogEvent, state_sink chan<- StateEvent) *Daemon {
@@ -56,6 +64,8 @@ func NewDaemon(hostname, motd string, log_sink chan<- LogEvent, state_sink chan<
 	daemon.clients = make(map[*Client]bool)
 	daemon.rooms = make(map[string]*Room)
 	daemon.room_sinks = make(map[*Room]chan ClientEvent)
+	daemon.admins = make(map[string]bool)
+	daemon.uploads = make(map[*Client]*bytes.Buffer)
 	daemon.log_sink = log_sink
 	daemon.state_sink = state_sink
 	return &daemon
@@ -208,7 +218,11 @@ func (daemon *Daemon) ClientRegister(client *Client, command string, cols []stri
 func (daemon *Daemon) RoomRegister(name string) (*Room, chan<- ClientEvent) {
 	room_new := NewRoom(daemon.hostname, name, daemon.log_sink, daemon.state_sink)
 	room_new.Verbose = daemon.Verbose
+	room_new.MaxRounds = daemon.MaxRounds
+	room_new.Difficulty = daemon.Difficulty
+	room_new.log_dir = daemon.log_dir
 	room_sink := make(chan ClientEvent)
+	room_new.sink = room_sink
 	daemon.rooms[name] = room_new
 	daemon.room_sinks[room_new] = room_sink
 	go room_new.Processor(room_sink)
@@ -331,6 +345,8 @@ func (daemon *Daemon) Processor(events <-chan ClientEvent) {
 			daemon.clients[client] = true
 		case EVENT_DEL:
 			delete(daemon.clients, client)
+			delete(daemon.uploads, client)
+			ReleaseClient(client)
 			for _, room_sink := range daemon.room_sinks {
 				room_sink <- event
 			}
@@ -467,6 +483,25 @@ func (daemon *Daemon) Processor(events <-chan ClientEvent) {
 					change = ""
 				}
 				daemon.room_sinks[r] <- ClientEvent{client, EVENT_TOPIC, change}
+			case "CHALLENGE", "ACCEPT", "DECLINE", "MOVE", "MOVES", "PASS", "FORFEIT", "STATUS":
+				r, found := daemon.rooms[client.inRoom]
+				if !found {
+					client.ReplyNoChannel(client.inRoom)
+					continue
+				}
+				daemon.room_sinks[r] <- ClientEvent{client, EVENT_BATTLE, strings.Join(cols, " ")}
+			case "CLAIM", "RELEASE":
+				daemon.HandlerClaim(client, command, cols)
+			case "CHARS":
+				daemon.HandlerChars(client, cols)
+			case "CHARINFO":
+				daemon.HandlerCharInfo(client, cols)
+			case "REPLAY":
+				daemon.HandlerReplay(client, cols)
+			case "UPLOAD":
+				daemon.HandlerUpload(client, cols)
+			case "APPROVE":
+				daemon.HandlerApprove(client, cols)
 			case "WHO":
 				if len(cols) == 1 || len(cols[1]) < 1 {
 					client.ReplyNotEnoughParameters("WHO")
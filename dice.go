@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAX_DICE  = 100  // The most dice that can be thrown in one roll.
+	MAX_SIDES = 1000 // The most sides a die can have.
+)
+
+type Dice struct { // The server's dice. Every roll in a battle comes from here, never from clients.
+	seed int64      // The seed the battle was started with, so it can be replayed.
+	rng  *rand.Rand // Where the numbers actually come from.
+}
+
+type DiceRoll struct { // The outcome of throwing some dice.
+	count    int   // How many dice were thrown.
+	sides    int   // How many sides each of them had.
+	dice     []int // What each individual die landed on.
+	modifier int   // What was added to the dice afterwards.
+	total    int   // The sum of the dice and the modifier.
+}
+
+func NewDice(seed int64) *Dice {
+	return &Dice{seed: seed, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Throw <count> dice with <sides> sides each, and add the modifier to them.
+func (dice *Dice) Roll(count, sides, modifier int) (DiceRoll, error) {
+	if count < 0 || count > MAX_DICE {
+		return DiceRoll{}, fmt.Errorf("Can't roll %d dice, it has to be between 0 and %d", count, MAX_DICE)
+	}
+	if sides < 1 || sides > MAX_SIDES {
+		return DiceRoll{}, fmt.Errorf("Can't roll a die with %d sides, it has to be between 1 and %d", sides, MAX_SIDES)
+	}
+	roll := DiceRoll{count: count, sides: sides, modifier: modifier, total: modifier}
+	for i := 0; i < count; i++ {
+		die := dice.rng.Intn(sides) + 1
+		roll.dice = append(roll.dice, die)
+		roll.total += die
+	}
+	return roll, nil
+}
+
+// Something like "2d20+3: [4 17] = 24"
+func (roll DiceRoll) String() string {
+	notation := fmt.Sprintf("%dd%d", roll.count, roll.sides)
+	if roll.sides == 0 {
+		notation = "fixed"
+	}
+	if roll.modifier > 0 {
+		notation += "+" + strconv.Itoa(roll.modifier)
+	} else if roll.modifier < 0 {
+		notation += strconv.Itoa(roll.modifier)
+	}
+	dice := []string{}
+	for _, die := range roll.dice {
+		dice = append(dice, strconv.Itoa(die))
+	}
+	return fmt.Sprintf("%s: [%s] = %d", notation, strings.Join(dice, " "), roll.total)
+}
+
+// Roll for an attacker against a defender. The attack hits if it meets or
+// beats the defender's defense roll.
+func (battle *Battle) RollAttack(attacker, defender *Combatant, count, sides, modifier int) (DiceRoll, DiceRoll, bool, error) {
+	attack, err := battle.dice.Roll(count, sides, modifier+attacker.stats.diceModAttack)
+	if err != nil {
+		return DiceRoll{}, DiceRoll{}, false, err
+	}
+	battle.Record(ReplayEvent{Event: "roll", Roll: attack.String()})
+	defense, err := battle.RollDefense(defender)
+	if err != nil {
+		return DiceRoll{}, DiceRoll{}, false, err
+	}
+	battle.Record(ReplayEvent{Event: "roll", Roll: defense.String()})
+	return attack, defense, attack.total >= defense.total, nil
+}
+
+// Roll a combatant's defense against an incoming attack.
+func (battle *Battle) RollDefense(defender *Combatant) (DiceRoll, error) {
+	if battle.dice == nil {
+		return DiceRoll{}, errors.New("This battle has no dice")
+	}
+	stats := defender.stats
+	if stats.diceType == DICE_FIXED {
+		return DiceRoll{count: 0, sides: 0, dice: []int{stats.diceValue}, modifier: stats.diceModDefense, total: stats.diceValue + stats.diceModDefense}, nil
+	}
+	return battle.dice.Roll(stats.diceAmount, stats.diceType, stats.diceModDefense)
+}
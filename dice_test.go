@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestDiceSameSeed(t *testing.T) {
+	a, b := NewDice(42), NewDice(42)
+	for i := 0; i < 20; i++ {
+		ra, _ := a.Roll(3, 20, 0)
+		rb, _ := b.Roll(3, 20, 0)
+		if ra.String() != rb.String() {
+			t.Fatalf("roll %d: %s and %s came from the same seed", i, ra, rb)
+		}
+	}
+}
+
+func TestDiceRoll(t *testing.T) {
+	tests := []struct {
+		count, sides, modifier int
+		ok                     bool
+	}{
+		{1, 20, 0, true},
+		{2, 6, 3, true},
+		{4, 1, -2, true},
+		{0, 20, 5, true},
+		{MAX_DICE, MAX_SIDES, 0, true},
+		{-1, 20, 0, false},
+		{MAX_DICE + 1, 20, 0, false},
+		{1, 0, 0, false},
+		{1, MAX_SIDES + 1, 0, false},
+	}
+	dice := NewDice(1)
+	for _, test := range tests {
+		roll, err := dice.Roll(test.count, test.sides, test.modifier)
+		if (err == nil) != test.ok {
+			t.Errorf("Roll(%d, %d, %d): got error %v", test.count, test.sides, test.modifier, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(roll.dice) != test.count {
+			t.Errorf("Roll(%d, %d, %d): threw %d dice", test.count, test.sides, test.modifier, len(roll.dice))
+		}
+		total := test.modifier
+		for _, die := range roll.dice {
+			if die < 1 || die > test.sides {
+				t.Errorf("Roll(%d, %d, %d): a die landed on %d", test.count, test.sides, test.modifier, die)
+			}
+			total += die
+		}
+		if roll.total != total {
+			t.Errorf("Roll(%d, %d, %d): total %d, want %d", test.count, test.sides, test.modifier, roll.total, total)
+		}
+	}
+}
+
+func TestDiceRollString(t *testing.T) {
+	tests := []struct {
+		roll DiceRoll
+		want string
+	}{
+		{DiceRoll{count: 2, sides: 20, dice: []int{4, 17}, modifier: 3, total: 24}, "2d20+3: [4 17] = 24"},
+		{DiceRoll{count: 1, sides: 6, dice: []int{5}, modifier: -2, total: 3}, "1d6-2: [5] = 3"},
+		{DiceRoll{dice: []int{7}, total: 7}, "fixed: [7] = 7"},
+	}
+	for _, test := range tests {
+		if got := test.roll.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
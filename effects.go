@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	EXPIRE_END   = iota // An effect's turns count down at the end of its holder's turns.
+	EXPIRE_START        // An effect's turns count down at the start of its holder's turns.
+)
+
+type Effect struct { // A move whose effects last for a while, like a passive or a buff.
+	move     *Move                   // The move it came from.
+	source   *Combatant              // Who used the move.
+	holder   *Combatant              // Who it's on. Its turns count down on their turns.
+	targets  []*Combatant            // Who the move was aimed at, so {target} means the same when it wears off.
+	opponent *Combatant              // The opponent that was picked for it, if one was.
+	bound    map[string][]*Combatant // Who each placeholder stood for when it started, so it's undone on the same combatants.
+	turns    int                     // How many more turns it lasts; 0 if it lasts until it's removed.
+	fresh    bool                    // Whether it started during the turn that's about to end, which doesn't count.
+}
+
+// Whether a move's effects last after it's been used, until they're undone by
+// its on_deactivate.
+func (move *Move) Lasts() bool {
+	return move.duration > 0 || move.until != nil
+}
+
+// Work out when a move's effects wear off from its "expires" key.
+func ParseExpires(expires string) (int, error) {
+	switch expires {
+	case "", "end":
+		return EXPIRE_END, nil
+	case "start":
+		return EXPIRE_START, nil
+	}
+	return 0, errors.New("expires has to be \"start\" or \"end\", not " + expires)
+}
+
+func (effect *Effect) String() string {
+	return fmt.Sprintf("%s's %s", effect.source, effect.move.Title())
+}
+
+// Run a move's on_activate and keep track of it until it wears off. If the move
+// doesn't stack and is already on its holder, it lasts longer instead.
+func (battle *Battle) ApplyEffect(ctx *CommandContext, move *Move) {
+	ctx.move = move
+	holder := ctx.me
+	if IsChosenTarget(move.target) && len(ctx.targets) == 1 {
+		holder = ctx.targets[0]
+	}
+	if !move.stacks {
+		for _, effect := range battle.effects {
+			if effect.move.name == move.name && effect.source == ctx.me && effect.holder == holder {
+				effect.turns = int(move.duration)
+				effect.fresh = move.expires == EXPIRE_END && holder == battle.Current()
+				if move.duration > 0 {
+					battle.Announce(fmt.Sprintf("%s on %s lasts %d more %s.", effect, holder, effect.turns, plural(effect.turns, "turn", "turns")))
+				}
+				return
+			}
+		}
+	}
+	effect := &Effect{
+		move:     move,
+		source:   ctx.me,
+		holder:   holder,
+		targets:  ctx.targets,
+		opponent: ctx.opponent,
+		bound:    make(map[string][]*Combatant),
+		turns:    int(move.duration),
+		fresh:    move.expires == EXPIRE_END && holder == battle.Current() && battle.state == BATTLE_ACTIVE,
+	}
+	battle.effects = append(battle.effects, effect)
+	ctx.bound = effect.bound
+	if err := ctx.Run(ctx.me.player.OnActivate(move)); err != nil {
+		battle.Announce(fmt.Sprintf("%s fizzled: %s", effect, err.Error()))
+	}
+	if move.duration > 0 {
+		battle.Announce(fmt.Sprintf("%s is on %s for %d %s.", effect, holder, effect.turns, plural(effect.turns, "turn", "turns")))
+	}
+}
+
+// Undo an effect with its move's on_deactivate.
+func (battle *Battle) RemoveEffect(effect *Effect, msg string) {
+	for i, e := range battle.effects {
+		if e == effect {
+			battle.effects = append(battle.effects[:i], battle.effects[i+1:]...)
+			break
+		}
+	}
+	if msg != "" {
+		battle.Announce(msg)
+	}
+	ctx := NewCommandContext(battle, effect.source, effect.source)
+	ctx.move = effect.move
+	ctx.targets = effect.targets
+	ctx.opponent = effect.opponent
+	ctx.bound = effect.bound
+	if err := ctx.Run(effect.source.player.OnDeactivate(effect.move)); err != nil {
+		battle.Announce(fmt.Sprintf("%s didn't wear off properly: %s", effect, err.Error()))
+	}
+}
+
+// Undo every effect that a combatant started or is holding, latest first,
+// because they've been defeated or left.
+func (battle *Battle) RemoveEffects(combatant *Combatant) {
+	for i := len(battle.effects) - 1; i >= 0; i-- {
+		if i >= len(battle.effects) {
+			continue
+		}
+		if effect := battle.effects[i]; effect.source == combatant || effect.holder == combatant {
+			battle.RemoveEffect(effect, "")
+		}
+	}
+}
+
+// Count down the effects on a combatant at the start or end of their turn,
+// then remove whichever have run out or whose "until" conditions are met.
+func (battle *Battle) TickEffects(holder *Combatant, expires int) {
+	var expired []*Effect
+	for _, effect := range battle.effects {
+		if effect.holder != holder || effect.move.expires != expires {
+			continue
+		}
+		if effect.fresh {
+			effect.fresh = false
+			continue
+		}
+		if effect.turns > 0 {
+			effect.turns--
+			if effect.turns == 0 {
+				expired = append(expired, effect)
+			}
+		}
+	}
+	for _, effect := range expired {
+		battle.RemoveEffect(effect, fmt.Sprintf("%s on %s wore off.", effect, effect.holder))
+	}
+	battle.CheckUntil()
+}
+
+// Remove every effect whose "until" conditions are met by its holder.
+func (battle *Battle) CheckUntil() {
+	var done []*Effect
+	for _, effect := range battle.effects {
+		if effect.move.until == nil {
+			continue
+		}
+		if met, err := battle.Meets(effect.holder, effect.move.until); err == nil && met {
+			done = append(done, effect)
+		}
+	}
+	for _, effect := range done {
+		battle.RemoveEffect(effect, fmt.Sprintf("%s on %s ended.", effect, effect.holder))
+	}
+}
+
+// Whether a combatant started an effect with the given name that's still going.
+func (battle *Battle) HasEffect(source *Combatant, name string) bool {
+	for _, effect := range battle.effects {
+		if effect.source == source && (strings.EqualFold(effect.move.name, name) || strings.EqualFold(effect.move.prettyName, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// List the effects on a combatant, like "Shield (2 turns left, from 8-BIT (alice))".
+func (battle *Battle) DescribeEffects(holder *Combatant) string {
+	described := []string{}
+	for _, effect := range battle.effects {
+		if effect.holder != holder {
+			continue
+		}
+		details := []string{}
+		if effect.turns > 0 {
+			details = append(details, fmt.Sprintf("%d %s left", effect.turns, plural(effect.turns, "turn", "turns")))
+		}
+		if effect.source != holder {
+			details = append(details, "from "+effect.source.String())
+		}
+		desc := effect.move.Title()
+		if len(details) > 0 {
+			desc += " (" + strings.Join(details, ", ") + ")"
+		}
+		described = append(described, desc)
+	}
+	return strings.Join(described, ", ")
+}
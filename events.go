@@ -24,6 +24,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"strconv"
 	"time"
 )
 
@@ -34,6 +35,9 @@ const (
 	EVENT_TOPIC = iota
 	EVENT_WHO   = iota
 	EVENT_MODE  = iota
+	EVENT_BATTLE = iota
+	EVENT_BATTLE_TIMEOUT = iota
+	EVENT_BATTLE_AI = iota
 	FORMAT_MSG  = "[%s] <%s> %s\n"
 	FORMAT_META = "[%s] * %s %s\n"
 )
@@ -47,7 +51,7 @@ type ClientEvent struct {
 }
 
 func (m ClientEvent) String() string {
-	return string(m.event_type) + ": " + m.client.String() + ": " + m.text
+	return strconv.Itoa(m.event_type) + ": " + m.client.String() + ": " + m.text
 }
 
 // Logging in-room events
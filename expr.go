@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Placeholders that stand for a number while commands run.
+var numberPlaceholders = map[string]bool{
+	"myRoll":    true, // The total of the last roll made by the move's owner.
+	"enemyRoll": true, // The total of the defense roll made against it.
+}
+
+// Placeholders that stand for one or more combatants.
+var targetPlaceholders = map[string]bool{
+	"me":       true, // Whoever the move belongs to.
+	"opponent": true, // Whoever they're fighting.
+	"team":     true, // Them and their allies.
+	"owner":    true, // Whoever summoned them, or themselves if nobody did.
+	"sender":   true, // Whoever caused the move to be used.
+	"target":   true, // Whoever the move was aimed at.
+}
+
+type exprParser struct { // Evaluates integer expressions like "{myRoll}-{enemyRoll}-5".
+	src    string                         // The expression.
+	pos    int                            // How far into it we are.
+	lookup func(name string) (int, error) // Gives us the value of a placeholder.
+}
+
+// Evaluate an integer expression, which can use + - * / %, brackets, and
+// placeholders in curly braces.
+func EvalExpr(src string, lookup func(name string) (int, error)) (int, error) {
+	p := &exprParser{src: src, lookup: lookup}
+	value, err := p.sum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return 0, fmt.Errorf("Unexpected %q at position %d of %q", p.src[p.pos], p.pos, p.src)
+	}
+	return value, nil
+}
+
+// List every placeholder named in a string, without the curly braces.
+func Placeholders(src string) ([]string, error) {
+	var names []string
+	for {
+		start := strings.Index(src, "{")
+		if start == -1 {
+			return names, nil
+		}
+		end := strings.Index(src[start:], "}")
+		if end == -1 {
+			return nil, errors.New("Unclosed { in " + src)
+		}
+		names = append(names, src[start+1:start+end])
+		src = src[start+end+1:]
+	}
+}
+
+// Check that every placeholder in an argument is one that commands know about.
+func CheckPlaceholders(arg string) error {
+	names, err := Placeholders(arg)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !numberPlaceholders[name] && !targetPlaceholders[name] {
+			return errors.New("Unknown placeholder {" + name + "}")
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// sum := product (('+' | '-') product)*
+func (p *exprParser) sum() (int, error) {
+	value, err := p.product()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return value, nil
+		}
+		p.pos++
+		rhs, err := p.product()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			value += rhs
+		} else {
+			value -= rhs
+		}
+	}
+}
+
+// product := unary (('*' | '/' | '%') unary)*
+func (p *exprParser) product() (int, error) {
+	value, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return value, nil
+		}
+		p.pos++
+		rhs, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			value *= rhs
+		case '/', '%':
+			if rhs == 0 {
+				return 0, errors.New("Division by zero in " + p.src)
+			}
+			if op == '/' {
+				value /= rhs
+			} else {
+				value %= rhs
+			}
+		}
+	}
+}
+
+// unary := ('-' | '+') unary | '(' sum ')' | number | placeholder
+func (p *exprParser) unary() (int, error) {
+	switch c := p.peek(); {
+	case c == '-' || c == '+':
+		p.pos++
+		value, err := p.unary()
+		if c == '-' {
+			value = -value
+		}
+		return value, err
+	case c == '(':
+		p.pos++
+		value, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, errors.New("Missing ) in " + p.src)
+		}
+		p.pos++
+		return value, nil
+	case c == '{':
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end == -1 {
+			return 0, errors.New("Unclosed { in " + p.src)
+		}
+		name := p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		return p.lookup(name)
+	case c >= '0' && c <= '9':
+		value := 0
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			value = value*10 + int(p.src[p.pos]-'0')
+			p.pos++
+		}
+		return value, nil
+	case c == 0:
+		return 0, errors.New("Unexpected end of " + p.src)
+	}
+	return 0, fmt.Errorf("Unexpected %q at position %d of %q", p.src[p.pos], p.pos, p.src)
+}
+
+// Look up the value of a number placeholder for the command that's running.
+func (ctx *CommandContext) lookupNumber(name string) (int, error) {
+	if targetPlaceholders[name] {
+		return 0, errors.New("{" + name + "} is a combatant, not a number")
+	}
+	if !numberPlaceholders[name] {
+		return 0, errors.New("Unknown placeholder {" + name + "}")
+	}
+	value, found := ctx.vars[name]
+	if !found {
+		return 0, errors.New("{" + name + "} hasn't been rolled yet")
+	}
+	return value, nil
+}
+
+// Look up which combatants a target placeholder refers to.
+func (ctx *CommandContext) lookupTargets(name string) ([]*Combatant, error) {
+	if targets, found := ctx.bound[name]; found {
+		return targets, nil
+	}
+	targets, err := ctx.resolveTargets(name)
+	if err == nil && ctx.bound != nil {
+		ctx.bound[name] = targets
+	}
+	return targets, err
+}
+
+func (ctx *CommandContext) resolveTargets(name string) ([]*Combatant, error) {
+	switch name {
+	case "me":
+		return []*Combatant{ctx.me}, nil
+	case "sender":
+		return []*Combatant{ctx.sender}, nil
+	case "owner":
+		if ctx.me.owner != nil {
+			return []*Combatant{ctx.me.owner}, nil
+		}
+		return []*Combatant{ctx.me}, nil
+	case "team":
+		return ctx.battle.Allies(ctx.me), nil
+	case "target":
+		if len(ctx.targets) == 0 {
+			return nil, errors.New("This wasn't aimed at anybody")
+		}
+		return ctx.targets, nil
+	case "opponent":
+		if ctx.opponent != nil && ctx.opponent.hp > 0 {
+			return []*Combatant{ctx.opponent}, nil
+		}
+		opponent := ctx.battle.OpponentOf(ctx.me)
+		if opponent == nil {
+			return nil, errors.New("There's nobody left to fight")
+		}
+		return []*Combatant{opponent}, nil
+	}
+	if numberPlaceholders[name] {
+		return nil, errors.New("{" + name + "} is a number, not a combatant")
+	}
+	return nil, errors.New("Unknown placeholder {" + name + "}")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvalExpr(t *testing.T) {
+	vars := map[string]int{"myRoll": 17, "enemyRoll": 9}
+	lookup := func(name string) (int, error) {
+		value, found := vars[name]
+		if !found {
+			return 0, errors.New("Unknown placeholder {" + name + "}")
+		}
+		return value, nil
+	}
+	tests := []struct {
+		src  string
+		want int
+		ok   bool
+	}{
+		{"5", 5, true},
+		{" 2 + 3 * 4 ", 14, true},
+		{"(2+3)*4", 20, true},
+		{"10-4-3", 3, true},
+		{"7/2", 3, true},
+		{"7%4", 3, true},
+		{"-3+-(2)", -5, true},
+		{"{myRoll}-{enemyRoll}-5", 3, true},
+		{"{myRoll}*2", 34, true},
+		{"", 0, false},
+		{"1/0", 0, false},
+		{"4%0", 0, false},
+		{"(1+2", 0, false},
+		{"1+", 0, false},
+		{"2 3", 0, false},
+		{"{myRoll", 0, false},
+		{"{nobody}", 0, false},
+		{"a", 0, false},
+	}
+	for _, test := range tests {
+		got, err := EvalExpr(test.src, lookup)
+		if (err == nil) != test.ok {
+			t.Errorf("EvalExpr(%q): got error %v", test.src, err)
+		} else if got != test.want {
+			t.Errorf("EvalExpr(%q) = %d, want %d", test.src, got, test.want)
+		}
+	}
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	tests := []struct {
+		arg string
+		ok  bool
+	}{
+		{"5", true},
+		{"{me}", true},
+		{"{myRoll}-{enemyRoll}", true},
+		{"{nobody}", false},
+		{"{me", false},
+	}
+	for _, test := range tests {
+		if err := CheckPlaceholders(test.arg); (err == nil) != test.ok {
+			t.Errorf("CheckPlaceholders(%q): got error %v", test.arg, err)
+		}
+	}
+}
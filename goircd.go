@@ -19,12 +19,12 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package main
 
 import (
-	"fmt"
 	"crypto/tls"
 	"flag"
 	"io/ioutil"
 	"log"
 	"net"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -36,6 +36,16 @@ var (
 	motd     = flag.String("motd", "", "Path to MOTD file")
 	logdir   = flag.String("logdir", "", "Absolute path to directory for logs")
 	statedir = flag.String("statedir", "", "Absolute path to directory for states")
+	playerdir = flag.String("playerdir", "./test_players", "Path to directory of character files")
+	uploaddir = flag.String("uploaddir", "", "Path to directory for uploaded character files; uploads are off without it")
+	admins    = flag.String("admins", "", "Comma-separated nicknames that can approve uploaded characters")
+	aidifficulty = flag.String("difficulty", "normal", "How well NPCs play unless a challenge says otherwise: random, easy, normal or greedy")
+	maxrounds = flag.Int("maxrounds", 0, "Rounds a battle can last before the team with the most HP wins; 0 for no limit")
+	validate  = flag.Bool("validate", false, "Check the character files given as arguments and exit.")
+	simulate  = flag.Bool("simulate", false, "Play the character files given as arguments against each other with NPC AI, report how they did and exit.")
+	battles   = flag.Int("battles", 1000, "How many battles -simulate plays")
+	format    = flag.String("format", "text", "How -simulate reports: text or json")
+	seed      = flag.Int64("seed", 0, "The seed for -simulate's first battle; 0 for a random one")
 
 	ssl     = flag.Bool("ssl", false, "Use SSL only.")
 	sslKey  = flag.String("ssl_key", "", "SSL keyfile.")
@@ -71,6 +81,13 @@ func Run() {
 	state_sink := make(chan StateEvent)
 	daemon := NewDaemon(*hostname, *motd, log_sink, state_sink)
 	daemon.Verbose = *verbose
+	daemon.MaxRounds = *maxrounds
+	difficulty, err := ParseDifficulty(*aidifficulty)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	daemon.Difficulty = difficulty
+	daemon.log_dir = *logdir
 	if *statedir == "" {
 		// Dummy statekeeper
 		go func() {
@@ -104,12 +121,20 @@ func Run() {
 		log.Println(*statedir, "statekeeper initialized")
 	}
 
-	// (delete later, maybe) Specify some default characters that players can control
-	err := LoadPlayer("./test_players/8bit.json","8-BIT")
-	if(err != nil) {
-		log.Println("\nCouldn't load the test player: \n"+err.Error())
+	// Load the characters that players can control, and keep them up to date
+	watcher := NewPlayerDir(*playerdir)
+	watcher.Scan()
+	go watcher.Watch(PLAYERDIR_POLL)
+	daemon.player_dir = *playerdir
+	daemon.upload_dir = *uploaddir
+	for _, admin := range strings.Split(*admins, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			daemon.admins[strings.ToLower(admin)] = true
+		}
+	}
+	if *uploaddir != "" {
+		LoadUploads(*uploaddir)
 	}
-	fmt.Println(recognizedPlayers)
 
 	// Beginning listening on a port
 	var listener net.Listener
@@ -146,5 +171,15 @@ func Run() {
 
 func main() {
 	flag.Parse()
+	if *validate {
+		os.Exit(RunValidate(flag.Args()))
+	}
+	if *simulate {
+		difficulty, err := ParseDifficulty(*aidifficulty)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(RunSimulate(flag.Args(), SimOptions{*battles, *seed, *maxrounds, difficulty, *format}))
+	}
 	Run()
 }
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Verb struct { // A built-in command that moves can use.
+	minArgs int                                                      // How many args it needs at the very least.
+	run     func(ctx *CommandContext, command Command) (bool, error) // Returns whether it succeeded.
+}
+
+var recognizedVerbs map[string]Verb
+
+type CommandContext struct { // The state that a tree of commands runs against.
+	battle   *Battle        // The battle the commands are running in.
+	me       *Combatant     // The combatant whose move this is.
+	sender   *Combatant     // The combatant that caused the move to be used.
+	targets  []*Combatant   // Who the move was aimed at, for {target}.
+	opponent *Combatant     // The opponent the player picked, if they picked one.
+	move     *Move          // The move whose commands these are, if they belong to one.
+	vars     map[string]int // Values set by earlier commands, like {myRoll}.
+
+	bound map[string][]*Combatant // Who placeholders like {team} stand for, once looked up, if they're being kept.
+}
+
+func init() {
+	recognizedVerbs = map[string]Verb{
+		"roll":         {2, VerbRoll},
+		"attack":       {2, VerbAttack},
+		"add":          {3, VerbAdd},
+		"subtract":     {3, VerbSubtract},
+		"sub":          {3, VerbSubtract},
+		"bot":          {0, VerbBot},
+		"move_attacks": {2, VerbMoveAttacks},
+	}
+}
+
+func NewCommandContext(battle *Battle, me, sender *Combatant) *CommandContext {
+	return &CommandContext{battle: battle, me: me, sender: sender, vars: make(map[string]int)}
+}
+
+// Run a list of commands in order, walking into on_succeed or on_fail for each
+// one depending on how it went.
+func (ctx *CommandContext) Run(commands []Command) error {
+	for _, command := range commands {
+		verb, found := recognizedVerbs[command.name]
+		if !found {
+			return errors.New("Unknown command: " + command.name)
+		}
+		ok, err := verb.run(ctx, command)
+		if err != nil {
+			return errors.New(command.name + ": " + err.Error())
+		}
+		if ok {
+			err = ctx.Run(command.on_succeed)
+		} else {
+			err = ctx.Run(command.on_fail)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check that every command in a tree is one we know how to run, so a broken
+// character is caught when it's loaded instead of in the middle of a battle.
+func ValidateCommands(commands []Command) error {
+	for _, command := range commands {
+		verb, found := recognizedVerbs[command.name]
+		if !found {
+			if command.name == "" {
+				return errors.New("A command was given without a name")
+			}
+			return errors.New("Unknown command: " + command.name)
+		}
+		if len(command.args) < verb.minArgs {
+			return fmt.Errorf("The %s command needs at least %d args, but got %d", command.name, verb.minArgs, len(command.args))
+		}
+		for _, arg := range command.args {
+			if err := CheckPlaceholders(arg); err != nil {
+				return errors.New("Bad argument to " + command.name + ": " + err.Error())
+			}
+		}
+		if command.name == "bot" {
+			if command.info.name == "" {
+				return errors.New("The bot command needs info about the character to summon")
+			}
+			if err := ValidateRepeats(command.info); err != nil {
+				return errors.New("Bad repeat in the bot " + command.info.name + ": \n" + err.Error())
+			}
+			if err := ValidatePlayer(command.info); err != nil {
+				return errors.New("Bad bot " + command.info.name + ": \n" + err.Error())
+			}
+		}
+		if err := ValidateCommands(command.on_succeed); err != nil {
+			return err
+		}
+		if err := ValidateCommands(command.on_fail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateMoves(moves *[]Move) error {
+	if moves == nil {
+		return nil
+	}
+	for _, move := range *moves {
+		if err := ValidateConditions(move.prereq); err != nil {
+			return errors.New("Bad conditions for " + move.name + ": \n" + err.Error())
+		}
+		if err := ValidateConditions(move.until); err != nil {
+			return errors.New("Bad until conditions for " + move.name + ": \n" + err.Error())
+		}
+		if err := ValidateCommands(move.on_activate); err != nil {
+			return errors.New("Bad on_activate for " + move.name + ": \n" + err.Error())
+		}
+		if err := ValidateCommands(move.on_deactivate); err != nil {
+			return errors.New("Bad on_deactivate for " + move.name + ": \n" + err.Error())
+		}
+	}
+	return nil
+}
+
+func ValidatePlayer(player Player) error {
+	for _, moves := range []*[]Move{player.passives, player.optionalPassives, player.actives} {
+		if err := ValidateMoves(moves); err != nil {
+			return err
+		}
+	}
+	if player.groups != nil {
+		for _, group := range *player.groups {
+			if err := ValidateConditions(group.prereq); err != nil {
+				return errors.New("Bad conditions for the " + group.name + " group: \n" + err.Error())
+			}
+			if err := ValidateMoves(&group.moves); err != nil {
+				return errors.New("Bad move in the " + group.name + " group: \n" + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Work out which combatants an argument like {opponent} refers to. Anything
+// that isn't a placeholder is taken as the name of a combatant, preferring
+// allies when both sides have somebody with that name.
+func (ctx *CommandContext) Targets(arg string) ([]*Combatant, error) {
+	arg = strings.TrimSpace(arg)
+	if strings.HasPrefix(arg, "{") && strings.HasSuffix(arg, "}") {
+		return ctx.lookupTargets(arg[1 : len(arg)-1])
+	}
+	for _, c := range append(ctx.battle.Allies(ctx.me), ctx.battle.combatants...) {
+		if strings.EqualFold(c.name, arg) {
+			return []*Combatant{c}, nil
+		}
+	}
+	return nil, errors.New("Nobody in the battle is called " + arg)
+}
+
+// Work out the number that an argument refers to.
+func (ctx *CommandContext) Number(arg string) (int, error) {
+	return EvalExpr(arg, ctx.lookupNumber)
+}
+
+// roll <count> <sides> [modifier]
+// Roll against the opponent's defense, succeeding if we meet or beat it.
+func VerbRoll(ctx *CommandContext, command Command) (bool, error) {
+	args := command.args
+	count, err := ctx.Number(args[0])
+	if err != nil {
+		return false, err
+	}
+	sides, err := ctx.Number(args[1])
+	if err != nil {
+		return false, err
+	}
+	modifier := 0
+	if len(args) > 2 {
+		modifier, err = ctx.Number(args[2])
+		if err != nil {
+			return false, err
+		}
+	}
+	opponents, err := ctx.lookupTargets("opponent")
+	if err != nil {
+		return false, errors.New("There's nobody left to roll against")
+	}
+	opponent := opponents[0]
+	attack, defense, hit, err := ctx.battle.RollAttack(ctx.me, opponent, count, sides, modifier)
+	if err != nil {
+		return false, err
+	}
+	ctx.vars["myRoll"] = attack.total
+	ctx.vars["enemyRoll"] = defense.total
+	result := "Miss!"
+	if hit {
+		result = "Hit!"
+	}
+	ctx.battle.Announce(fmt.Sprintf("%s rolled %s against %s's defense of %s. %s", ctx.me, attack, opponent, defense, result))
+	return hit, nil
+}
+
+// attack <target> <damage>
+func VerbAttack(ctx *CommandContext, command Command) (bool, error) {
+	args := command.args
+	targets, err := ctx.Targets(args[0])
+	if err != nil {
+		return false, err
+	}
+	damage, err := ctx.Number(args[1])
+	if err != nil {
+		return false, err
+	}
+	damage += ctx.me.stats.attack
+	if damage < 0 {
+		damage = 0
+	}
+	for _, target := range targets {
+		ctx.battle.DeclareAttack(ctx.me, target, damage, ctx.move)
+	}
+	return true, nil
+}
+
+// add <stat> <target> <amount>
+func VerbAdd(ctx *CommandContext, command Command) (bool, error) {
+	return ctx.changeStat(command.args, 1)
+}
+
+// subtract <stat> <target> <amount>
+func VerbSubtract(ctx *CommandContext, command Command) (bool, error) {
+	return ctx.changeStat(command.args, -1)
+}
+
+func (ctx *CommandContext) changeStat(args []string, sign int) (bool, error) {
+	targets, err := ctx.Targets(args[1])
+	if err != nil {
+		return false, err
+	}
+	amount, err := ctx.Number(args[2])
+	if err != nil {
+		return false, err
+	}
+	for _, target := range targets {
+		stat, err := target.Stat(args[0])
+		if err != nil {
+			return false, err
+		}
+		standing := target.hp > 0
+		*stat += sign * amount
+		// Losing HP this way defeats them just like an attack would.
+		if standing && target.hp <= 0 && ctx.battle.IndexOf(target) >= 0 {
+			ctx.battle.Defeat(target, fmt.Sprintf("%s was defeated!", target))
+		}
+	}
+	return true, nil
+}
+
+// bot, with the character to summon given as its info
+func VerbBot(ctx *CommandContext, command Command) (bool, error) {
+	if ctx.me.hp <= 0 {
+		return false, errors.New(ctx.me.name + " can't summon anything while defeated")
+	}
+	ctx.battle.Summon(ctx.me, command.info)
+	return true, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// A move library is a file of moves that any character can use, so a common
+// move only has to be written and balanced once. It looks like
+//
+//	{"library": "common", "moves": [{"name": "punch", ...}, ...]}
+//
+// and characters use its moves with {"use": "common.punch"}, adding any keys
+// they want to override.
+
+type LibraryFile struct {
+	Library *string           `json:"library"`
+	Moves   []json.RawMessage `json:"moves"`
+}
+
+var recognizedMoves map[string]json.RawMessage // Library moves as written, by qualified name.
+var movesLock sync.RWMutex
+
+func init() {
+	recognizedMoves = make(map[string]json.RawMessage)
+}
+
+// Whether the contents of a file are a move library rather than a character.
+func IsLibrary(file []byte) bool {
+	var o map[string]json.RawMessage
+	if json.Unmarshal(file, &o) != nil {
+		return false
+	}
+	_, found := o["library"]
+	return found
+}
+
+// Check a move library, returning its name and its moves by qualified name.
+func ParseLibrary(file []byte) (string, map[string]json.RawMessage, error) {
+	var library LibraryFile
+	if err := json.Unmarshal(file, &library); err != nil {
+		return "", nil, errors.New("Could not unmarshal the move library: \n" + err.Error())
+	}
+	if library.Library == nil || *library.Library == "" || strings.Contains(*library.Library, ".") {
+		return "", nil, errors.New("A move library needs a name without dots in it")
+	}
+	name := *library.Library
+	moves := make(map[string]json.RawMessage)
+	for _, raw := range library.Moves {
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &keys); err != nil || keys == nil {
+			return "", nil, errors.New("Every move in the " + name + " library has to be an object")
+		}
+		if _, found := keys["use"]; found {
+			return "", nil, errors.New("Moves in the " + name + " library can't use other library moves")
+		}
+		var file MoveFile
+		if err := json.Unmarshal(raw, &file); err != nil {
+			return "", nil, errors.New("Couldn't parse a move in the " + name + " library: \n" + err.Error())
+		}
+		if file.Name == "" {
+			return "", nil, errors.New("A move in the " + name + " library has no name")
+		}
+		move, err := ParseMove(file)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := ValidateMoves(&[]Move{move}); err != nil {
+			return "", nil, err
+		}
+		qualified := name + "." + file.Name
+		if _, found := moves[qualified]; found {
+			return "", nil, errors.New("The " + name + " library has two moves called " + file.Name)
+		}
+		moves[qualified] = raw
+	}
+	return name, moves, nil
+}
+
+// Make a library's moves available, replacing whatever it had before.
+func RegisterLibrary(name string, moves map[string]json.RawMessage) {
+	movesLock.Lock()
+	defer movesLock.Unlock()
+	unregisterLibrary(name)
+	for qualified, raw := range moves {
+		recognizedMoves[qualified] = raw
+	}
+}
+
+func UnregisterLibrary(name string) {
+	movesLock.Lock()
+	defer movesLock.Unlock()
+	unregisterLibrary(name)
+}
+
+func unregisterLibrary(name string) {
+	for qualified := range recognizedMoves {
+		if strings.HasPrefix(qualified, name+".") {
+			delete(recognizedMoves, qualified)
+		}
+	}
+}
+
+func GetLibraryMove(qualified string) (json.RawMessage, bool) {
+	movesLock.RLock()
+	defer movesLock.RUnlock()
+	raw, found := recognizedMoves[qualified]
+	return raw, found
+}
+
+// Replace a move that uses a library move with the library move, overlaid
+// with whatever keys the character gave it.
+func ResolveLibraryMove(data []byte) ([]byte, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil || keys == nil {
+		return data, nil
+	}
+	use, found := keys["use"]
+	if !found {
+		return data, nil
+	}
+	var qualified string
+	if err := json.Unmarshal(use, &qualified); err != nil {
+		return nil, errors.New("The move to use has to be given as a string, like \"common.punch\"")
+	}
+	raw, found := GetLibraryMove(qualified)
+	if !found {
+		return nil, errors.New("There's no library move called " + qualified)
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range keys {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+// Fill in every move in a file that uses a library move, so that the file
+// stands on its own even if the library changes.
+func ResolveLibraryMoves(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	resolved, err := resolveUses(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resolved)
+}
+
+func resolveUses(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if _, found := v["use"]; found {
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			merged, err := ResolveLibraryMove(raw)
+			if err != nil {
+				return nil, err
+			}
+			v = nil
+			if err := json.Unmarshal(merged, &v); err != nil {
+				return nil, err
+			}
+			delete(v, "use")
+		}
+		for key, x := range v {
+			resolved, err := resolveUses(x)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = resolved
+		}
+		return v, nil
+	case []interface{}:
+		for i, x := range v {
+			resolved, err := resolveUses(x)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Whether a client is allowed to claim a character: it has to be theirs, or
+// belong to everybody.
+func (player Player) ClaimableBy(client *Client) bool {
+	return player.owner == "*" || strings.EqualFold(player.owner, client.nickname)
+}
+
+// Check that a client can pick a character for a battle. Nobody else can pick
+// a character while it's claimed.
+func (player Player) CheckControl(client *Client) error {
+	if player.owner_conn != nil && player.owner_conn != client {
+		return errors.New(player.name + " has been claimed by " + player.owner_conn.nickname)
+	}
+	if !player.ClaimableBy(client) {
+		return errors.New(player.name + " belongs to " + player.owner)
+	}
+	return nil
+}
+
+// Claim a character, so that nobody else can play as it until it's released.
+func ClaimPlayer(name string, client *Client) error {
+	playersLock.Lock()
+	defer playersLock.Unlock()
+	player, found := recognizedPlayers[name]
+	if !found {
+		return errors.New("There is no character named " + name)
+	}
+	if player.owner_conn == client {
+		return errors.New("You've already claimed " + name)
+	}
+	if err := player.CheckControl(client); err != nil {
+		return err
+	}
+	player.owner_conn = client
+	recognizedPlayers[name] = player
+	return nil
+}
+
+// Give up a character that a client has claimed.
+func ReleasePlayer(name string, client *Client) error {
+	playersLock.Lock()
+	defer playersLock.Unlock()
+	player, found := recognizedPlayers[name]
+	if !found {
+		return errors.New("There is no character named " + name)
+	}
+	if player.owner_conn != client {
+		return errors.New("You haven't claimed " + name)
+	}
+	player.owner_conn = nil
+	recognizedPlayers[name] = player
+	return nil
+}
+
+// Release every character a client has claimed, once they've disconnected.
+func ReleaseClient(client *Client) {
+	playersLock.Lock()
+	defer playersLock.Unlock()
+	for name, player := range recognizedPlayers {
+		if player.owner_conn == client {
+			player.owner_conn = nil
+			recognizedPlayers[name] = player
+		}
+	}
+}
+
+func (daemon *Daemon) HandlerClaim(client *Client, command string, cols []string) {
+	if len(cols) == 1 || strings.TrimSpace(cols[1]) == "" {
+		client.ReplyNotEnoughParameters(command)
+		return
+	}
+	name := strings.TrimSpace(cols[1])
+	var err error
+	if command == "CLAIM" {
+		err = ClaimPlayer(name, client)
+	} else {
+		err = ReleasePlayer(name, client)
+	}
+	if err != nil {
+		client.ReplyNicknamed(err.Error())
+		return
+	}
+	if command == "CLAIM" {
+		client.ReplyNicknamed("You've claimed " + name + ". Nobody else can play as them until you RELEASE them.")
+	} else {
+		client.ReplyNicknamed("You've released " + name + ".")
+	}
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	//"fmt"
+	"fmt"
 	"os"
-	"encoding/json"
 	"errors"
-	"strconv"
-	"strings"
+	"sync"
 )
 
 
@@ -18,13 +16,19 @@ type Player struct {	// A player character that somebody can control in battle.
 
 	aggressive 			bool			// Whether they're an NPC or not
 	hp 					int			// Their HP.
+	bio 				string 			// Description of the character.
+	stats 				Stats 			// The stats they start every battle with.
 
 	passives  			*[]Move			// Moves that are activated when the player enters battle
 	optionalPassives 	*[]Move 		// Moves that have lasting effects until the user perishes.
 	actives 			*[]Move			// Moves that the player can active themselves.
+	groups 				*[]Group 		// Groups of moves that the player can active themselves.
+
+	source 				[]byte 			// The file they were loaded from, with library moves filled in, so battles can be replayed.
 }
 
 var recognizedPlayers map[string]Player
+var playersLock sync.RWMutex 					// Characters can be reloaded while rooms are reading them.
 
 type Move struct {		// A move that the player can either have used at the start of a battle, or used on their turn.  
 	name 				string 			// Name of the move, internally.
@@ -33,12 +37,26 @@ type Move struct {		// A move that the player can either have used at the start
 	instruction 		string			// How the move plays out.
 	cooldown  			int16 			// How many turns a player can use this move
 	limit	  			int16 			// How many times this move can be used.
+	prereq 				[]Condition 	// A set of conditions that dictate when this move is visible.
+	reactive 			bool 			// Whether it's used on somebody else's turn, in reaction to an attack.
+	repeat 				string 			// Another of the character's moves whose effects this one re-applies.
+	target 				int 			// Who the move is aimed at; one of the TARGET_ constants.
+	duration 			int16 			// How many turns its effects last before on_deactivate, if they last.
+	stacks 				bool 			// Whether using it again adds another effect, rather than making the first one last longer.
+	expires 			int 			// Whether its turns count down at the start or end of a turn; one of the EXPIRE_ constants.
+	until 				[]Condition 	// Conditions that end its effects early, once its holder meets them.
 
 	on_activate 		[]Command 		// Commands executed once the move is used.
 	on_deactivate 		[]Command		// Commands executed after the move is used.
 }
 
-var recognizedMoveTables [][]Move
+// The name to show for a move; its pretty name if it has one.
+func (move Move) Title() (string) {
+	if(move.prettyName != "") {
+		return move.prettyName
+	}
+	return move.name
+}
 
 type Group struct {		// A group of moves, usually visible when a passive is active.
 	name 				string 			// Group name
@@ -52,6 +70,15 @@ type Group struct {		// A group of moves, usually visible when a passive is acti
 	limit 				int16 			// How many times any of the moves in this group can be used.
 
 	moves		 		[]Move			// The moves in this group
+	reactive 			bool 			// Whether the moves are used on somebody else's turn.
+}
+
+// The name to show for a group; its pretty name if it has one.
+func (group Group) Title() (string) {
+	if(group.prettyName != "") {
+		return group.prettyName
+	}
+	return group.name
 }
 
 type Command struct {	// A command that a move activates in battle
@@ -71,261 +98,393 @@ func init() {
 	recognizedPlayers = make(map[string]Player)
 }
 
-func LoadPlayer(filename, playername string) (error) {
+// Load a player file and make the character in it available to everyone,
+// under the name given by its "character" field.
+func LoadPlayer(filename string) (Player, error) {
+	player, err := ReadPlayer(filename)
+	if(err != nil) {
+		return Player{}, err
+	}
+	RegisterPlayer(player)
+	return player, nil
+}
+
+// Read a player file into a player object, without registering it.
+func ReadPlayer(filename string) (Player, error) {
 	// Get the filename
 	file, err := os.ReadFile(filename)
 	if(err != nil) {
-		return errors.New("Couldn't read player file: \n"+err.Error())
+		return Player{}, errors.New("Couldn't read player file: \n"+err.Error())
 	}
+	return ParsePlayer(file)
+}
+
+// Turn the contents of a player file into a player object.
+func ParsePlayer(file []byte) (Player, error) {
 	// Create a new object from the file
-	var jsonFile map[string]json.RawMessage
-	err = json.Unmarshal(file, &jsonFile)
+	jsonFile, err := DecodePlayer(file)
 	if err != nil {
-		return errors.New("Could not unmarshal the player file: \n"+err.Error())
+		return Player{}, errors.New("Could not unmarshal the player file: \n"+err.Error())
 	}
 
 	player, err := NewPlayer(jsonFile)
 	if(err != nil) {
-		return errors.New("Couldn't load the player file into a player object: \n"+err.Error())
+		return Player{}, errors.New("Couldn't load the player file into a player object: \n"+err.Error())
+	}
+	err = ValidateRepeats(player)
+	if(err != nil) {
+		return Player{}, errors.New("The player file has a move whose repeat can't be followed: \n"+err.Error())
+	}
+	err = ValidatePlayer(player)
+	if(err != nil) {
+		return Player{}, errors.New("The player file uses commands that can't be run: \n"+err.Error())
+	}
+	player.source, err = ResolveLibraryMoves(file)
+	if(err != nil) {
+		return Player{}, errors.New("Couldn't fill in the library moves: \n"+err.Error())
+	}
+
+	return player, nil
+}
+
+func RegisterPlayer(player Player) {
+	playersLock.Lock()
+	defer playersLock.Unlock()
+	// Whoever claimed the character keeps it through a reload, so long as it's still theirs to claim.
+	if old, found := recognizedPlayers[player.name]; found && old.owner_conn != nil && player.ClaimableBy(old.owner_conn) {
+		player.owner_conn = old.owner_conn
 	}
+	recognizedPlayers[player.name] = player
+}
 
-	recognizedPlayers[playername] = player
+func UnregisterPlayer(name string) {
+	playersLock.Lock()
+	defer playersLock.Unlock()
+	delete(recognizedPlayers, name)
+}
 
-	return nil
+// Look up a character by name. What's returned is a copy, so it stays the same
+// even if the character's file is reloaded afterwards.
+func GetPlayer(name string) (Player, bool) {
+	playersLock.RLock()
+	defer playersLock.RUnlock()
+	player, found := recognizedPlayers[name]
+	return player, found
 }
 
-func NewPlayer(o map[string]json.RawMessage) (Player, error) {
+func NewPlayer(o PlayerFile) (Player, error) {
 	// All the values we want
 
 	var name, owner string
 	var aggressive bool
 	var hp int
 	var passives, optionalPassives, actives *[]Move
+	var groups *[]Group
+	var bio string
+	stats := defaultStats
 
 	var err error
 
 	// The first three values are actually required, an error should be thrown if they're not present.
-	if(o["character"] != nil) {
-		name = string(o["character"])
+	if(o.Character != nil) {
+		name = *o.Character
 	} else {
 		return Player{}, errors.New("No name was given for this player.")
 	}
-	if(o["owner"] != nil) {
-		owner = string(o["owner"])
+	if(o.Owner != nil) {
+		owner = *o.Owner
 	} else {
 		return Player{}, errors.New("No owner nickname was given for this player.")
 	}
-	if(o["aggressive"] != nil) {
-		aggressive_ := string(o["aggressive"])
-		switch(aggressive_) {
-			case "\"false\"", "\"no\"":
-				aggressive = false
-			case "\"true\"", "\"yes\"":
-				aggressive = true
-			default:
-				return Player{}, errors.New("The player's aggressive value wasn't true or false, it was "+aggressive_)
-		}
+	if(o.Aggressive != nil) {
+		aggressive = bool(*o.Aggressive)
 	} else {
 		return Player{}, errors.New("This player wasn't specified to be aggressive or not")
 	}
 
-	if(o["hp"] != nil) {
-		hpstr := strings.Replace(string(o["hp"]),"\"","",2)
-		hp, err = strconv.Atoi(hpstr)
-		if(err != nil) {
-			return Player{}, errors.New("Invalid HP given: "+hpstr)
-		}
+	if(o.HP != nil) {
+		hp = int(*o.HP)
 	} else {
 		hp = 1
 	}
+	err = CheckHP(hp)
+	if(err != nil) {
+		return Player{}, errors.New("Couldn't load "+name+": \n"+err.Error())
+	}
+
+	if(o.Info != nil) {
+		stats, bio, err = ParseInfo(*o.Info)
+		if(err != nil) {
+			return Player{}, errors.New("Couldn't parse the info for "+name+": \n"+err.Error())
+		}
+	}
 
 	// Load the moves
-	if(o["actives"] != nil) {
-		actives, err = ParseMoveTable(o["actives"])
+	if(o.Actives != nil) {
+		actives, groups, err = ParseMoveTable(o.Actives)
 		if err != nil {return Player{}, err}
 	}
-	if(o["optional_passives"] != nil) {
-		optionalPassives, err = ParseMoveTable(o["optional_passives"])
+	if(o.OptionalPassives != nil) {
+		optionalPassives, err = ParsePassiveTable(o.OptionalPassives)
 		if err != nil {return Player{}, err}
 	}
-	if(o["passives"] != nil) {
-		passives, err = ParseMoveTable(o["passives"])
+	if(o.Passives != nil) {
+		passives, err = ParsePassiveTable(o.Passives)
 		if err != nil {return Player{}, err}
 	}
 
 
-	player := Player{name,owner,nil,aggressive,hp,passives,optionalPassives,actives}
+	player := Player{
+		name: name,
+		owner: owner,
+		aggressive: aggressive,
+		hp: hp,
+		bio: bio,
+		stats: stats,
+		passives: passives,
+		optionalPassives: optionalPassives,
+		actives: actives,
+		groups: groups,
+	}
 	return player, nil
 }
 
-func ParseMoveTable(table []byte) (*[]Move, error) {
+func ParseMoveTable(table []MoveEntry) (*[]Move, *[]Group, error) {
 	var moves []Move
-	// Create a new object from the table
-	var moveObj []interface{}
-	err := json.Unmarshal(table, &moveObj)
-	if err != nil {
-		return nil, errors.New("Could not unmarshal the move table: \n"+err.Error())
-	}
-	// And create a new object for each of the moves
-	for _, v := range moveObj {
-		move, err := ParseMove(v)
+	var groups []Group
+	// Create a new object for each of the moves, or groups of moves
+	for _, v := range table {
+		if(v.group != nil) {
+			group, err := ParseGroup(*v.group)
+			if(err != nil) {
+				return nil, nil, err
+			}
+			groups = append(groups, group)
+			continue
+		}
+		move, err := ParseMove(*v.move)
 		if(err != nil) {
-			return nil, err
+			return nil, nil, err
 		}
 		moves = append(moves, move)
 	}
+	var movesPtr *[]Move
+	var groupsPtr *[]Group
 	if(len(moves) >= 1) {
-		recognizedMoveTables = append(recognizedMoveTables, moves)
-		return &moves, nil
+		movesPtr = &moves
+	}
+	if(len(groups) >= 1) {
+		groupsPtr = &groups
 	}
-	return nil, nil
+	return movesPtr, groupsPtr, nil
 }
 
-func ParseMove(move interface{}) (Move, error) {
-	w, ok := move.(map[string]interface{})
-	if(ok) {
-		// Start getting the values to fill our move with
-		var name, prettyname, bio, instruction string
-		var cooldown, limit int
-		var onActivate []Command
-		var onDeactivate []Command
-		var err error
+// Passives can't be grouped, since there's nothing to choose between.
+func ParsePassiveTable(table []MoveEntry) (*[]Move, error) {
+	moves, groups, err := ParseMoveTable(table)
+	if(err != nil) {
+		return nil, err
+	}
+	if(groups != nil) {
+		return nil, errors.New("The group "+(*groups)[0].name+" is in a passives table, but only actives can be grouped")
+	}
+	return moves, nil
+}
 
-		if(w["name"] != nil) {name = w["name"].(string)}
-		if(w["prettyname"] != nil) {prettyname = w["prettyname"].(string)}
-		if(w["bio"] != nil) {bio = w["bio"].(string)}
-		if(w["instruction"] != nil) {instruction = w["instruction"].(string)}
+// Whether an entry in a move table is a group of moves rather than a move.
+func IsGroup(entry interface{}) (bool) {
+	w, ok := entry.(map[string]interface{})
+	if(!ok) {
+		return false
+	}
+	_, ok = w["group"]
+	return ok
+}
 
-		if(w["cooldown"] != nil) {
-			cooldown, err = strconv.Atoi(w["cooldown"].(string))
-			if(err != nil) {
-				return Move{}, errors.New("Couldn't parse the cooldown for "+name+": \n"+err.Error())
-			}
-		}
-		if(w["limit"] != nil) {
-			limit, err = strconv.Atoi(w["limit"].(string))
-			if(err != nil) {
-				return Move{}, errors.New("Couldn't parse the limit for "+name+": \n"+err.Error())
-			}
-		}
+func ParseGroup(w GroupFile) (Group, error) {
+	var moves []Move
+	name := w.Group
+	if(name == "") {
+		return Group{}, errors.New("A group was given without a name")
+	}
+	err := ValidateUsage(name, int(w.Cooldown), int(w.Limit))
+	if(err != nil) {
+		return Group{}, err
+	}
+	prereq, err := ParseConditions(w.Conditions)
+	if(err != nil) {
+		return Group{}, errors.New("Couldn't parse the conditions for the "+name+" group: \n"+err.Error())
+	}
+	_, err = ParseTarget(w.Target, w.Self)
+	if(err != nil) {
+		return Group{}, errors.New("Couldn't parse the target for the "+name+" group: \n"+err.Error())
+	}
 
-		// Parse the commands on each of these moves.
-		if(w["on_activate"] != nil) {
-			onActivate, err = ParseCommandTable(w["on_activate"])
-			if(err != nil) {
-				return Move{}, errors.New("Couldn't parse on_activate for "+name+": \n"+err.Error())
-			}
+	if(w.Attacks == nil) {
+		return Group{}, errors.New("The "+name+" group has no attacks array")
+	}
+	for _, v := range *w.Attacks {
+		// Moves aim wherever their group does, unless they say otherwise.
+		if(v.Target == "" && v.Self == nil) {
+			v.Target, v.Self = w.Target, w.Self
 		}
-		if(w["on_deactivate"] != nil) {
-			onDeactivate, err = ParseCommandTable(w["on_deactivate"])
-			if(err != nil) {
-				return Move{}, errors.New("Couldn't parse on_deactivate for "+name+": \n"+err.Error())
-			}
+		move, err := ParseMove(v)
+		if(err != nil) {
+			return Group{}, errors.New("Couldn't parse a move in the "+name+" group: \n"+err.Error())
 		}
+		moves = append(moves, move)
+	}
+
+	group := Group{
+		name: name,
+		prettyName: w.PrettyName,
+		bio: w.Bio,
+		prereq: prereq,
+		prereq_string: w.Prereq,
+		cooldown: int16(w.Cooldown),
+		limit: int16(w.Limit),
+		moves: moves,
+		reactive: bool(w.Reactive),
+	}
+	return group, nil
+}
 
-		move := Move{
-			name: name,
-			prettyName: prettyname,
-			bio: bio,
-			instruction: instruction,
-			cooldown: int16(cooldown),
-			limit: int16(limit),
-			on_activate: onActivate,
-			on_deactivate: onDeactivate,
+// Booleans in character files are written as true/false, or as the strings
+// "true"/"false" or "yes"/"no".
+func ParseBool(v interface{}) (bool, error) {
+	switch(fmt.Sprint(v)) {
+		case "false", "no":
+			return false, nil
+		case "true", "yes":
+			return true, nil
+	}
+	return false, errors.New("Expected true or false, got "+describeJSON(v))
+}
+
+func ParseConditions(table ConditionList) ([]Condition, error) {
+	var conditions []Condition
+	for _, x := range table {
+		if(x.Meets == "") {
+			return nil, errors.New("A condition was given without saying what it meets")
 		}
-		return move, nil
+		conditions = append(conditions, Condition{x.Name, x.Meets})
+	}
+	return conditions, nil
+}
+
+func ParseMove(w MoveFile) (Move, error) {
+	name := w.Name
+	err := ValidateUsage(name, int(w.Cooldown), int(w.Limit))
+	if(err != nil) {
+		return Move{}, err
+	}
+	prereq, err := ParseConditions(w.Conditions)
+	if(err != nil) {
+		return Move{}, errors.New("Couldn't parse the conditions for "+name+": \n"+err.Error())
+	}
+	target, err := ParseTarget(w.Target, w.Self)
+	if(err != nil) {
+		return Move{}, errors.New("Couldn't parse the target for "+name+": \n"+err.Error())
+	}
+	err = CheckCount("duration", name, int(w.Duration))
+	if(err != nil) {
+		return Move{}, err
+	}
+	expires, err := ParseExpires(w.Expires)
+	if(err != nil) {
+		return Move{}, errors.New("Couldn't parse when "+name+" expires: \n"+err.Error())
+	}
+	until, err := ParseConditions(w.Until)
+	if(err != nil) {
+		return Move{}, errors.New("Couldn't parse the until conditions for "+name+": \n"+err.Error())
+	}
+
+	// Parse the commands on each of these moves.
+	onActivate, err := ParseCommandTable(w.OnActivate)
+	if(err != nil) {
+		return Move{}, errors.New("Couldn't parse on_activate for "+name+": \n"+err.Error())
+	}
+	onDeactivate, err := ParseCommandTable(w.OnDeactivate)
+	if(err != nil) {
+		return Move{}, errors.New("Couldn't parse on_deactivate for "+name+": \n"+err.Error())
+	}
+
+	move := Move{
+		name: name,
+		prettyName: w.PrettyName,
+		bio: w.Bio,
+		instruction: w.Instruction,
+		cooldown: int16(w.Cooldown),
+		limit: int16(w.Limit),
+		prereq: prereq,
+		reactive: bool(w.Reactive),
+		repeat: w.Repeat,
+		target: target,
+		duration: int16(w.Duration),
+		stacks: bool(w.Stacks),
+		expires: expires,
+		until: until,
+		on_activate: onActivate,
+		on_deactivate: onDeactivate,
 	}
-	return Move{}, errors.New("Rare error where a move cannot be unwrapped into an array of strings")
+	return move, nil
 }
 
-func ParseCommandTable(table interface{}) ([]Command, error) {
+func ParseCommandTable(table CommandList) ([]Command, error) {
 	var commands []Command
-	// Is it an array of commands?
-	v, ok := table.([]interface{})
-	// If so, parse each one.
-	if(ok) {
-		for _, w := range v {
-			x, ok := w.(map[string]interface{})
-			if(ok) {
-				command, err := ParseCommand(x)
-				if(err != nil) {
-					if(x["name"] != nil) {
-						var name string
-						name = x["command"].(string)
-						return nil, errors.New("Couldn't parse the "+name+" command: \n\n"+err.Error())
-					} else {
-						return nil, errors.New("Couldn't parse the an unnamed command: \n\n"+err.Error())
-					}
-				}
-				commands = append(commands, command)
+	for _, w := range table {
+		command, err := ParseCommand(w)
+		if(err != nil) {
+			if(w.Command != "") {
+				return nil, errors.New("Couldn't parse the "+w.Command+" command: \n\n"+err.Error())
 			} else {
-				commands = append(commands, Command{})
-			}
-		}
-	// Otherwise, we only need to parse one.
-	} else {
-		w, ok := table.(map[string]interface{})
-		if(ok) {
-			command, err := ParseCommand(w)
-			if(err != nil) {
-				if(w["name"] != nil) {
-					var name string
-					name = w["command"].(string)
-					return nil, errors.New("Couldn't parse the "+name+" command: \n\n"+err.Error())
-				} else {
-					return nil, errors.New("Couldn't parse the an unnamed command: \n\n"+err.Error())
-				}
+				return nil, errors.New("Couldn't parse the an unnamed command: \n\n"+err.Error())
 			}
-			commands = append(commands, command)
-		} else {
-			commands = append(commands, Command{})
 		}
+		commands = append(commands, command)
 	}
 	return commands, nil
 }
 
-func ParseCommand(s map[string]interface{}) (Command, error) {
-	var name string
-	var args []string
-	var on_succeed, on_fail []Command
-	var info Player //(the bot command currently isn't implemented)
-	var err error
-	if(s["command"] != nil) {
-		name = s["command"].(string)
-	}
-	if(s["args"] != nil) {
-		// args is actually an interface too, we have to convert the strings individually
-		v, ok := s["args"].([]interface{})
-		if(ok) {
-			for _, w := range v {
-				args = append(args,w.(string))
-			}
+func ParseCommand(s CommandFile) (Command, error) {
+	var info Player // (only used by the bot command)
+	name := s.Command
+	if(s.Info != nil) {
+		var err error
+		info, err = ParseBot(*s.Info)
+		if(err != nil) {
+			return Command{}, errors.New("Couldn't parse the player for a "+name+" command: \n"+err.Error())
 		}
 	}
-	if(s["on_succeed"] != nil) {
-		v, ok := s["on_succeed"].(map[string]interface{})
-		if(ok) {
-			on_succeed, err = ParseCommandTable(v)
-			if(err != nil) {
-				return Command{}, errors.New("Couldn't parse a "+name+" command's on_succeed: \n"+err.Error())
-			}
-		}
+	on_succeed, err := ParseCommandTable(s.OnSucceed)
+	if(err != nil) {
+		return Command{}, errors.New("Couldn't parse a "+name+" command's on_succeed: \n"+err.Error())
 	}
-	if(s["on_fail"] != nil) {
-		v, ok := s["on_fail"].(map[string]interface{})
-		if(ok) {
-			on_fail, err = ParseCommandTable(v)
-			if(err != nil) {
-				return Command{}, errors.New("Couldn't parse a "+name+" command's on_fail: \n"+err.Error())
-			}
-		}
+	on_fail, err := ParseCommandTable(s.OnFail)
+	if(err != nil) {
+		return Command{}, errors.New("Couldn't parse a "+name+" command's on_fail: \n"+err.Error())
 	}
 	command := Command{
 		name: name,
-		args: args,
+		args: s.Args,
 		on_succeed: on_succeed,
 		on_fail: on_fail,
 		info: info,
 	}
 	return command, nil
-}
\ No newline at end of file
+}
+
+// Parse a player that a bot command summons. Bots belong to whoever summoned
+// them, so they don't need an owner, and they can keep their aggressive and hp
+// values in their info block.
+func ParseBot(bot PlayerFile) (Player, error) {
+	if(bot.Info != nil) {
+		if(bot.Aggressive == nil) {bot.Aggressive = bot.Info.Aggressive}
+		if(bot.HP == nil) {bot.HP = bot.Info.HP}
+	}
+	if(bot.Owner == nil) {
+		owner := "*"
+		bot.Owner = &owner
+	}
+	return NewPlayer(bot)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	PLAYERDIR_POLL = time.Second * 2 // How often the character directory is checked for changes
+)
+
+type PlayerDir struct { // A directory of character files that gets reloaded when they change.
+	path      string               // Where the directory is.
+	modTimes  map[string]time.Time // When each file was last changed, as of the last scan.
+	names     map[string]string    // The character that each file defined, by filename.
+	libraries map[string]string    // The move library that each file defined, by filename.
+}
+
+func NewPlayerDir(path string) *PlayerDir {
+	return &PlayerDir{path: path, modTimes: make(map[string]time.Time), names: make(map[string]string), libraries: make(map[string]string)}
+}
+
+// Load every character file and move library that's new or changed since the
+// last scan, and forget the ones whose files were deleted. Libraries are
+// loaded first, and when one changes, every character is loaded again so they
+// pick up the change. Battles that are already going on keep the characters
+// they started with.
+func (dir *PlayerDir) Scan() {
+	entries, err := os.ReadDir(dir.path)
+	if err != nil {
+		log.Println("Can not read playerdir", dir.path, err)
+		return
+	}
+	seen := make(map[string]bool)
+	characters := make(map[string][]byte)
+	librariesChanged := false
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		filename := filepath.Join(dir.path, entry.Name())
+		seen[filename] = true
+		info, err := entry.Info()
+		if err != nil {
+			log.Println("Can not stat character file", filename, err)
+			continue
+		}
+		if last, found := dir.modTimes[filename]; found && last.Equal(info.ModTime()) {
+			continue
+		}
+		dir.modTimes[filename] = info.ModTime()
+		file, err := os.ReadFile(filename)
+		if err != nil {
+			log.Println("Can not read character file", filename, err)
+			continue
+		}
+		if IsLibrary(file) {
+			librariesChanged = true
+			dir.loadLibrary(filename, file)
+		} else {
+			if name, found := dir.libraries[filename]; found {
+				librariesChanged = true
+				delete(dir.libraries, filename)
+				UnregisterLibrary(name)
+			}
+			characters[filename] = file
+		}
+	}
+	for filename, name := range dir.libraries {
+		if !seen[filename] {
+			librariesChanged = true
+			delete(dir.libraries, filename)
+			delete(dir.modTimes, filename)
+			UnregisterLibrary(name)
+			log.Printf("Unloaded the %s library, since %s is gone", name, filename)
+		}
+	}
+	if librariesChanged {
+		for filename := range seen {
+			_, isLibrary := dir.libraries[filename]
+			if _, found := characters[filename]; !found && !isLibrary {
+				if file, err := os.ReadFile(filename); err == nil {
+					characters[filename] = file
+				}
+			}
+		}
+	}
+	filenames := []string{}
+	for filename := range characters {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		dir.loadCharacter(filename, characters[filename])
+	}
+	for filename, name := range dir.names {
+		if !seen[filename] {
+			dir.forget(filename)
+			delete(dir.modTimes, filename)
+			log.Printf("Unloaded %s, since %s is gone", name, filename)
+		}
+	}
+}
+
+func (dir *PlayerDir) loadLibrary(filename string, file []byte) {
+	name, moves, err := ParseLibrary(file)
+	if err != nil {
+		log.Printf("Can not load move library %s: %v", filename, err)
+		return
+	}
+	if old, found := dir.libraries[filename]; found && old != name {
+		UnregisterLibrary(old)
+	}
+	dir.libraries[filename] = name
+	RegisterLibrary(name, moves)
+	log.Printf("Loaded the %s library from %s", name, filename)
+}
+
+func (dir *PlayerDir) loadCharacter(filename string, file []byte) {
+	player, err := ParsePlayer(file)
+	if err != nil {
+		log.Printf("Can not load character file %s: %v", filename, err)
+		return
+	}
+	if old, found := dir.names[filename]; found && old != player.name {
+		dir.forget(filename)
+	}
+	for other, name := range dir.names {
+		if other != filename && name == player.name {
+			log.Printf("%s and %s both define %s; using %s", other, filename, name, filename)
+		}
+	}
+	dir.names[filename] = player.name
+	RegisterPlayer(player)
+	log.Printf("Loaded %s from %s", player.name, filename)
+}
+
+// Stop using the character a file defined. If another file defines a character
+// with the same name, it gets loaded again on the next scan.
+func (dir *PlayerDir) forget(filename string) {
+	name := dir.names[filename]
+	delete(dir.names, filename)
+	for other, otherName := range dir.names {
+		if otherName == name {
+			delete(dir.modTimes, other)
+			return
+		}
+	}
+	UnregisterPlayer(name)
+}
+
+// Check the directory for changes forever.
+func (dir *PlayerDir) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		dir.Scan()
+	}
+}
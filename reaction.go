@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	REACTION_TIMEOUT = time.Second * 20 // How long combatants get to react to an attack
+)
+
+type Attack struct { // An attack that's been declared, but hasn't landed yet.
+	attacker *Combatant // Who's attacking.
+	target   *Combatant // Who's going to take the damage.
+	damage   int        // How much damage they're going to take.
+	move     *Move      // The move it came from, if it came from one.
+}
+
+type ReactionWindow struct { // The time between attacks being declared and landing.
+	id      int                 // Tells apart windows, so a late timeout doesn't close the wrong one.
+	waiting map[*Combatant]bool // The combatants that can still react.
+}
+
+// Whether a move can only be used on somebody else's turn, in reaction to
+// being attacked.
+func IsReactive(move *Move, group *Group) bool {
+	return move.reactive || (group != nil && group.reactive)
+}
+
+// Declare an attack. It lands when the turn ends, after anybody who can react
+// to it has had the chance to.
+func (battle *Battle) DeclareAttack(attacker, target *Combatant, damage int, move *Move) {
+	battle.attacks = append(battle.attacks, &Attack{attacker, target, damage, move})
+	battle.Announce(fmt.Sprintf("%s is attacking %s for %d damage.", attacker, target, damage))
+}
+
+// Send every declared attack at whoever it's aimed at now.
+func (battle *Battle) ResolveAttacks() {
+	battle.reaction = nil
+	attacks := battle.attacks
+	battle.attacks = nil
+	for _, attack := range attacks {
+		// Attacks from anybody who's been defeated or left since don't land.
+		if attack.attacker.hp <= 0 || battle.IndexOf(attack.attacker) < 0 {
+			continue
+		}
+		if attack.target.hp > 0 {
+			event := ReplayEvent{Event: "damage", Who: battle.IndexOf(attack.attacker), Targets: []int{battle.IndexOf(attack.target)}, Damage: attack.damage}
+			if attack.move != nil {
+				event.Move = attack.move.name
+			}
+			battle.Record(event)
+		}
+		battle.Damage(attack.attacker, attack.target, attack.damage)
+	}
+}
+
+// Aim the attacks that are going at one combatant at another one instead.
+func (battle *Battle) MoveAttacks(from, to *Combatant) int {
+	moved := 0
+	for _, attack := range battle.attacks {
+		if attack.target == from {
+			attack.target = to
+			moved++
+		}
+	}
+	if moved > 0 {
+		battle.Announce(fmt.Sprintf("%s takes the attack meant for %s!", to, from))
+	}
+	return moved
+}
+
+// Whether a combatant has any reactive move they could use right now.
+func (battle *Battle) CanReact(combatant *Combatant) bool {
+	can := false
+	combatant.EachActive(func(move *Move, group *Group) {
+		if can || !IsReactive(move, group) || !battle.Available(combatant, move, group) {
+			return
+		}
+		if group != nil && combatant.CanUse(group.Key(), group.Title(), group.limit) != nil {
+			return
+		}
+		can = combatant.CanUse(move.name, move.Title(), move.limit) == nil
+	})
+	return can
+}
+
+// Once a move has been played, give the combatants being attacked a chance to
+// react. If nobody can, the attacks land and the turn ends straight away.
+func (battle *Battle) OpenReactions() {
+	if battle.state != BATTLE_ACTIVE {
+		return
+	}
+	waiting := make(map[*Combatant]bool)
+	for _, attack := range battle.attacks {
+		for _, c := range battle.Allies(attack.target) {
+			if c != battle.Current() && c.Controller() != nil && battle.CanReact(c) {
+				waiting[c] = true
+			}
+		}
+	}
+	if len(waiting) == 0 {
+		battle.EndTurn()
+		return
+	}
+	battle.reactions++
+	battle.reaction = &ReactionWindow{id: battle.reactions, waiting: waiting}
+	for c := range waiting {
+		c.Controller().ReplyNicknamed(fmt.Sprintf("%s can react with MOVE <move>, or PASS. You have %d seconds.", c.name, int(REACTION_TIMEOUT.Seconds())))
+	}
+	if battle.room.sink != nil && !battle.replaying {
+		id, sink := battle.reaction.id, battle.room.sink
+		time.AfterFunc(REACTION_TIMEOUT, func() {
+			sink <- ClientEvent{nil, EVENT_BATTLE_TIMEOUT, battle.TimerID(id)}
+		})
+	}
+}
+
+// The combatant a client can react as, if they're allowed to react right now.
+// When they could react as more than one, like themselves and a bot, it's
+// whichever comes first in the turn order.
+func (battle *Battle) Reactor(client *Client) *Combatant {
+	if battle.reaction == nil {
+		return nil
+	}
+	for _, c := range battle.combatants {
+		if battle.reaction.waiting[c] && c.Controller() == client {
+			return c
+		}
+	}
+	return nil
+}
+
+// Play a reactive move in response to the attacks that were just declared.
+func (battle *Battle) UseReaction(combatant *Combatant, name, target string) error {
+	move, group := combatant.FindActive(name)
+	if move == nil {
+		return errors.New(combatant.name + " has no move called " + name)
+	}
+	if !IsReactive(move, group) {
+		return errors.New(move.Title() + " can only be used on your own turn.")
+	}
+	targets, err := battle.ChooseTargets(combatant, move, target)
+	if err != nil {
+		return err
+	}
+	return battle.React(combatant, move, group, targets)
+}
+
+// Play a reactive move, once it's been picked and aimed.
+func (battle *Battle) React(combatant *Combatant, move *Move, group *Group, targets []*Combatant) error {
+	if err := battle.PrepareMove(combatant, move, group); err != nil {
+		return err
+	}
+	battle.Record(battle.moveEvent("react", combatant, move, group, targets))
+	battle.PlayMove(combatant, move, targets)
+	battle.DoneReacting(combatant)
+	return nil
+}
+
+// Let a combatant pass up their chance to react.
+func (battle *Battle) SkipReaction(combatant *Combatant) {
+	battle.Record(ReplayEvent{Event: "skip", Who: battle.IndexOf(combatant)})
+	battle.Announce(combatant.String() + " doesn't react.")
+	battle.DoneReacting(combatant)
+}
+
+// Mark a combatant as done reacting, and end the turn if everybody is.
+func (battle *Battle) DoneReacting(combatant *Combatant) {
+	if battle.reaction == nil {
+		return
+	}
+	delete(battle.reaction.waiting, combatant)
+	if len(battle.reaction.waiting) == 0 {
+		battle.EndTurn()
+	}
+}
+
+// Called when the time to react runs out.
+func (battle *Battle) ReactionTimeout(id string) {
+	if battle.reaction == nil || battle.TimerID(battle.reaction.id) != id {
+		return
+	}
+	battle.ExpireReactions()
+}
+
+// Stop waiting for anybody else to react.
+func (battle *Battle) ExpireReactions() {
+	battle.Record(ReplayEvent{Event: "timeout"})
+	names := []string{}
+	for _, c := range battle.combatants {
+		if battle.reaction.waiting[c] {
+			names = append(names, c.String())
+		}
+	}
+	battle.Announce("Time's up for " + strings.Join(names, ", ") + " to react.")
+	battle.EndTurn()
+}
+
+// move_attacks <from> <to>
+func VerbMoveAttacks(ctx *CommandContext, command Command) (bool, error) {
+	from, err := ctx.Targets(command.args[0])
+	if err != nil {
+		return false, err
+	}
+	to, err := ctx.Targets(command.args[1])
+	if err != nil {
+		return false, err
+	}
+	if len(to) != 1 {
+		return false, errors.New("Attacks can only be moved onto one combatant")
+	}
+	if to[0].hp <= 0 {
+		return false, errors.New(to[0].name + " isn't standing anymore")
+	}
+	moved := 0
+	for _, c := range from {
+		moved += ctx.battle.MoveAttacks(c, to[0])
+	}
+	return moved > 0, nil
+}
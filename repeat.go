@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Find one of a character's moves by its internal name, wherever it is.
+func (player Player) FindMove(name string) *Move {
+	var found *Move
+	player.eachMove(func(move *Move) {
+		if found == nil && move.name == name {
+			found = move
+		}
+	})
+	return found
+}
+
+func (player Player) eachMove(fn func(move *Move)) {
+	for _, moves := range []*[]Move{player.passives, player.optionalPassives, player.actives} {
+		if moves == nil {
+			continue
+		}
+		for i := range *moves {
+			fn(&(*moves)[i])
+		}
+	}
+	if player.groups != nil {
+		for i := range *player.groups {
+			group := &(*player.groups)[i]
+			for j := range group.moves {
+				fn(&group.moves[j])
+			}
+		}
+	}
+}
+
+// The commands to run when a move is activated: those of the move it repeats,
+// if it repeats one, then its own.
+func (player Player) OnActivate(move *Move) []Command {
+	var commands []Command
+	if move.repeat != "" {
+		if repeated := player.FindMove(move.repeat); repeated != nil {
+			commands = append(commands, player.OnActivate(repeated)...)
+		}
+	}
+	return append(commands, move.on_activate...)
+}
+
+// The commands to run when a move is deactivated, undoing OnActivate in the
+// opposite order.
+func (player Player) OnDeactivate(move *Move) []Command {
+	commands := append([]Command{}, move.on_deactivate...)
+	if move.repeat != "" {
+		if repeated := player.FindMove(move.repeat); repeated != nil {
+			commands = append(commands, player.OnDeactivate(repeated)...)
+		}
+	}
+	return commands
+}
+
+// Check that every move a character repeats exists, and that no move ends up
+// repeating itself.
+func ValidateRepeats(player Player) error {
+	var err error
+	player.eachMove(func(move *Move) {
+		if err != nil || move.repeat == "" {
+			return
+		}
+		chain := []string{move.name}
+		seen := map[string]bool{move.name: true}
+		for current := move; current.repeat != ""; {
+			next := player.FindMove(current.repeat)
+			if next == nil {
+				err = errors.New(current.name + " repeats " + current.repeat + ", but there's no move called that")
+				return
+			}
+			chain = append(chain, next.name)
+			if seen[next.name] {
+				err = errors.New(move.name + " repeats itself: " + strings.Join(chain, " -> "))
+				return
+			}
+			seen[next.name] = true
+			current = next
+		}
+	})
+	return err
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	REPLAY_INTERVAL  = time.Second // How long a replay waits between messages at normal speed.
+	MAX_REPLAY_SPEED = 100         // The fastest a replay can be played, as a multiple of normal speed.
+)
+
+// Every battle is recorded as a list of events, one JSON object per line,
+// in a .replay file next to the room's log. The first event has the seed and
+// the characters as they were; the rest are what the players did and the
+// rolls that came of it. Playing the same things against the same seed always
+// ends up the same way, which is checked against the recorded rolls.
+
+type ReplayEvent struct { // Something that happened in a battle.
+	Event      string            `json:"event"` // start, move, react, pass, skip, forfeit, timeout, roll, damage or end.
+	Who        int               `json:"who"`   // Where the combatant was in the turn order at the time.
+	Move       string            `json:"move,omitempty"`
+	Group      string            `json:"group,omitempty"`
+	Targets    []int             `json:"targets,omitempty"`
+	Roll       string            `json:"roll,omitempty"`
+	Damage     int               `json:"damage,omitempty"`
+	Seed       int64             `json:"seed,omitempty"`
+	Room       string            `json:"room,omitempty"`
+	MaxRounds  int               `json:"max_rounds,omitempty"`
+	FirstTeam  int               `json:"first_team,omitempty"`
+	Combatants []ReplayCombatant `json:"combatants,omitempty"`
+}
+
+type ReplayCombatant struct { // Somebody in a recorded battle, as they were when it started.
+	Nick       string          `json:"nick,omitempty"` // Empty for NPCs.
+	Team       int             `json:"team"`
+	Difficulty int             `json:"difficulty"`
+	File       json.RawMessage `json:"file"` // Their character file, with library moves filled in.
+}
+
+// Start a fresh record of the battle with everybody in it.
+func (battle *Battle) StartRecording() {
+	start := ReplayEvent{Event: "start", Seed: battle.dice.seed, Room: battle.room.name, MaxRounds: battle.maxRounds, FirstTeam: battle.firstTeam}
+	for _, c := range battle.combatants {
+		rc := ReplayCombatant{Team: c.team, Difficulty: c.difficulty, File: c.player.source}
+		if c.client != nil {
+			rc.Nick = c.client.nickname
+		}
+		start.Combatants = append(start.Combatants, rc)
+	}
+	battle.record = []ReplayEvent{start}
+	// The battle's number keeps two that end in the same second apart.
+	battle.replayID = fmt.Sprintf("%s.%s.%d", battle.room.name, time.Now().Format("20060102-150405"), battle.id)
+}
+
+func (battle *Battle) Record(event ReplayEvent) {
+	if battle.observe != nil {
+		battle.observe(event)
+	}
+	if battle.record != nil {
+		battle.record = append(battle.record, event)
+	}
+}
+
+func (battle *Battle) moveEvent(kind string, combatant *Combatant, move *Move, group *Group, targets []*Combatant) ReplayEvent {
+	event := ReplayEvent{Event: kind, Who: battle.IndexOf(combatant), Move: move.name}
+	if group != nil {
+		event.Group = group.name
+	}
+	for _, target := range targets {
+		event.Targets = append(event.Targets, battle.IndexOf(target))
+	}
+	return event
+}
+
+// End the battle, and store its record so it can be replayed.
+func (battle *Battle) End(msg string) {
+	battle.state = BATTLE_OVER
+	battle.Announce(msg)
+	battle.Record(ReplayEvent{Event: "end"})
+	if battle.replaying || battle.room.log_dir == "" || battle.record == nil {
+		return
+	}
+	var buf bytes.Buffer
+	for _, event := range battle.record {
+		line, err := json.Marshal(event)
+		if err != nil {
+			log.Println("Can not record battle", battle.replayID, err)
+			return
+		}
+		buf.Write(append(line, '\n'))
+	}
+	filename := filepath.Join(battle.room.log_dir, battle.replayID+".replay")
+	if err := os.WriteFile(filename, buf.Bytes(), 0660); err != nil {
+		log.Println("Can not write replay", filename, err)
+		return
+	}
+	battle.Announce("Watch this battle again with REPLAY " + battle.replayID)
+}
+
+func LoadReplay(filename string) ([]ReplayEvent, error) {
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var events []ReplayEvent
+	scanner := bufio.NewScanner(bytes.NewReader(file))
+	scanner.Buffer(nil, len(file)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var event ReplayEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// Play a recorded battle again from its seed, returning everything that was
+// announced in it. It's an error if it doesn't play out the way it did the
+// first time.
+func Replay(events []ReplayEvent) ([]string, error) {
+	if len(events) == 0 || events[0].Event != "start" {
+		return nil, errors.New("That isn't a battle recording")
+	}
+	start := events[0]
+	var transcript []string
+	battle := &Battle{
+		room:      &Room{name: start.Room, members: make(map[*Client]bool)},
+		state:     BATTLE_PENDING,
+		round:     1,
+		maxRounds: start.MaxRounds,
+		firstTeam: start.FirstTeam,
+		dice:      NewDice(start.Seed),
+		replaying: true,
+		watch:     func(msg string) { transcript = append(transcript, msg) },
+	}
+	for _, rc := range start.Combatants {
+		player, err := ParsePlayer(rc.File)
+		if err != nil {
+			return nil, errors.New("Couldn't load a character from the recording: \n" + err.Error())
+		}
+		var client *Client
+		if rc.Nick != "" {
+			// Somebody to play them, who doesn't have to be online.
+			client = &Client{nickname: rc.Nick}
+		}
+		battle.AddCombatant(player, client, rc.Team, rc.Difficulty)
+	}
+	battle.Start()
+	for _, event := range events[1:] {
+		if err := battle.Apply(event); err != nil {
+			return transcript, err
+		}
+	}
+	if !sameRolls(battle.record, events) {
+		return transcript, errors.New("The replay didn't play out the way the battle did")
+	}
+	return transcript, nil
+}
+
+// Do whatever a recorded event says was done.
+func (battle *Battle) Apply(event ReplayEvent) error {
+	switch event.Event {
+	case "roll", "damage", "end":
+		return nil
+	case "timeout":
+		if battle.reaction != nil {
+			battle.ExpireReactions()
+		}
+		return nil
+	}
+	if event.Who < 0 || event.Who >= len(battle.combatants) {
+		return fmt.Errorf("Nobody is at %d in the turn order", event.Who)
+	}
+	combatant := battle.combatants[event.Who]
+	switch event.Event {
+	case "pass":
+		battle.Pass(combatant)
+	case "skip":
+		battle.SkipReaction(combatant)
+	case "forfeit":
+		battle.Forfeit(combatant)
+	case "move", "react":
+		move, group := combatant.FindRecordedMove(event.Move, event.Group)
+		if move == nil {
+			return errors.New(combatant.name + " has no move called " + event.Move)
+		}
+		var targets []*Combatant
+		for _, i := range event.Targets {
+			if i < 0 || i >= len(battle.combatants) {
+				return fmt.Errorf("Nobody is at %d in the turn order", i)
+			}
+			targets = append(targets, battle.combatants[i])
+		}
+		if event.Event == "react" {
+			return battle.React(combatant, move, group, targets)
+		}
+		return battle.TakeTurn(combatant, move, group, targets)
+	default:
+		return errors.New("Unknown event " + event.Event)
+	}
+	return nil
+}
+
+// Find an active move by its internal name, and the name of the group it's in.
+func (combatant *Combatant) FindRecordedMove(name, groupName string) (*Move, *Group) {
+	var found *Move
+	var foundGroup *Group
+	combatant.EachActive(func(move *Move, group *Group) {
+		inGroup := (group == nil && groupName == "") || (group != nil && group.name == groupName)
+		if found == nil && move.name == name && inGroup {
+			found, foundGroup = move, group
+		}
+	})
+	return found, foundGroup
+}
+
+func sameRolls(a, b []ReplayEvent) bool {
+	rolls := func(events []ReplayEvent) []string {
+		var rolls []string
+		for _, event := range events {
+			if event.Event == "roll" {
+				rolls = append(rolls, event.Roll)
+			}
+		}
+		return rolls
+	}
+	ra, rb := rolls(a), rolls(b)
+	if len(ra) != len(rb) {
+		return false
+	}
+	for i := range ra {
+		if ra[i] != rb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// REPLAY [page] lists the recorded battles, and REPLAY <battle> [speed] plays
+// one back, at the given multiple of normal speed.
+func (daemon *Daemon) HandlerReplay(client *Client, cols []string) {
+	if daemon.log_dir == "" {
+		client.ReplyNicknamed("Battles aren't being recorded on this server.")
+		return
+	}
+	var args []string
+	if len(cols) > 1 {
+		args = strings.Fields(cols[1])
+	}
+	if len(args) == 0 || len(args) == 1 && !strings.Contains(args[0], ".") {
+		_, page := splitPage(args)
+		ReplyPage(client, daemon.ListReplays(), page, "REPLAY")
+		return
+	}
+	id := args[0]
+	speed := 1.0
+	if len(args) > 1 {
+		var err error
+		speed, err = strconv.ParseFloat(args[1], 64)
+		if err != nil || speed <= 0 || speed > MAX_REPLAY_SPEED {
+			client.ReplyNicknamed(fmt.Sprintf("The speed has to be a number above 0 and up to %d.", MAX_REPLAY_SPEED))
+			return
+		}
+	}
+	if filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		client.ReplyNicknamed("There's no recorded battle called " + id)
+		return
+	}
+	filename := filepath.Join(daemon.log_dir, id+".replay")
+	// Playing the battle again can take a while, so it's done away from
+	// everybody else's commands.
+	go func() {
+		events, err := LoadReplay(filename)
+		if err != nil {
+			client.ReplyNicknamed("There's no recorded battle called " + id)
+			return
+		}
+		transcript, err := Replay(events)
+		if err != nil {
+			client.ReplyNicknamed("Can't replay " + id + ": " + strings.Join(strings.Fields(err.Error()), " "))
+			return
+		}
+		client.ReplyNicknamed(fmt.Sprintf("Replaying %s at %gx speed.", id, speed))
+		interval := time.Duration(float64(REPLAY_INTERVAL) / speed)
+		for _, msg := range transcript {
+			time.Sleep(interval)
+			client.ReplyNicknamed(msg)
+		}
+		client.ReplyNicknamed("That's the end of " + id + ".")
+	}()
+}
+
+// The recorded battles, newest first.
+func (daemon *Daemon) ListReplays() []string {
+	filenames, _ := filepath.Glob(filepath.Join(daemon.log_dir, "*.replay"))
+	type replay struct {
+		id      string
+		modTime time.Time
+	}
+	var replays []replay
+	for _, filename := range filenames {
+		info, err := os.Stat(filename)
+		if err != nil {
+			continue
+		}
+		replays = append(replays, replay{strings.TrimSuffix(filepath.Base(filename), ".replay"), info.ModTime()})
+	}
+	sort.Slice(replays, func(i, j int) bool {
+		return replays[i].modTime.After(replays[j].modTime)
+	})
+	lines := []string{}
+	for _, r := range replays {
+		lines = append(lines, r.id)
+	}
+	if len(lines) == 0 {
+		return []string{"No battles have been recorded yet."}
+	}
+	return append(lines, "Use REPLAY <battle> [speed] to watch one.")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Play 8-BIT against itself with the NPC AI on both sides.
+func playBattle(t *testing.T, seed int64) *Battle {
+	player, err := ReadPlayer("test_players/8bit.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	battle := &Battle{
+		room:      &Room{name: "test", members: make(map[*Client]bool)},
+		state:     BATTLE_PENDING,
+		round:     1,
+		maxRounds: SIM_MAX_ROUNDS,
+		dice:      NewDice(seed),
+	}
+	battle.AddCombatant(player, nil, 0, 0)
+	battle.AddCombatant(player, nil, 1, 0)
+	battle.Start()
+	for battle.state == BATTLE_ACTIVE {
+		if battle.reaction != nil {
+			battle.ExpireReactions()
+			continue
+		}
+		turn := battle.aiTurns
+		battle.PlayAI(battle.TimerID(turn))
+		if battle.state == BATTLE_ACTIVE && battle.aiTurns == turn {
+			battle.Pass(battle.Current())
+		}
+	}
+	return battle
+}
+
+func TestReplay(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3, 12345} {
+		battle := playBattle(t, seed)
+		if _, err := Replay(battle.record); err != nil {
+			t.Errorf("seed %d: %v", seed, err)
+		}
+	}
+}
+
+func TestReplayTampered(t *testing.T) {
+	battle := playBattle(t, 7)
+	tests := []struct {
+		name   string
+		tamper func(events []ReplayEvent) []ReplayEvent
+	}{
+		{"changed roll", func(events []ReplayEvent) []ReplayEvent {
+			for i := range events {
+				if events[i].Event == "roll" {
+					events[i].Roll = strings.Replace(events[i].Roll, "=", "= 1", 1)
+					break
+				}
+			}
+			return events
+		}},
+		{"extra roll", func(events []ReplayEvent) []ReplayEvent {
+			return append(events, ReplayEvent{Event: "roll", Roll: "1d20: [20] = 20"})
+		}},
+		{"other seed", func(events []ReplayEvent) []ReplayEvent {
+			events[0].Seed++
+			return events
+		}},
+	}
+	for _, test := range tests {
+		events := test.tamper(append([]ReplayEvent(nil), battle.record...))
+		if _, err := Replay(events); err == nil {
+			t.Errorf("%s: replayed without an error", test.name)
+		}
+	}
+	if _, err := Replay(nil); err == nil {
+		t.Error("an empty recording replayed without an error")
+	}
+}
+
+func TestSameRolls(t *testing.T) {
+	roll := func(s string) ReplayEvent { return ReplayEvent{Event: "roll", Roll: s} }
+	tests := []struct {
+		a, b []ReplayEvent
+		want bool
+	}{
+		{nil, nil, true},
+		{[]ReplayEvent{roll("1d20: [3] = 3")}, []ReplayEvent{{Event: "pass"}, roll("1d20: [3] = 3")}, true},
+		{[]ReplayEvent{roll("1d20: [3] = 3")}, []ReplayEvent{roll("1d20: [4] = 4")}, false},
+		{[]ReplayEvent{roll("1d20: [3] = 3")}, nil, false},
+	}
+	for i, test := range tests {
+		if got := sameRolls(test.a, test.b); got != test.want {
+			t.Errorf("case %d: got %v, want %v", i, got, test.want)
+		}
+	}
+}
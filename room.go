@@ -38,13 +38,19 @@ func RoomNameValid(name string) bool {
 
 type Room struct {
 	Verbose    bool
+	MaxRounds  int
+	Difficulty int
 	name       string
 	topic      string
 	key        string
 	members    map[*Client]bool
 	hostname   string
 	log_sink   chan<- LogEvent
+	log_dir    string
 	state_sink chan<- StateEvent
+	battle     *Battle
+	battles    int
+	sink       chan<- ClientEvent
 }
 
 func NewRoom(hostname, name string, log_sink chan<- LogEvent, state_sink chan<- StateEvent) *Room {
@@ -76,6 +82,13 @@ func (room *Room) Broadcast(msg string, client_to_ignore ...*Client) {
 	}
 }
 
+// Send a message to all room's subscribers, written for each one of them
+func (room *Room) BroadcastEach(msg func(member *Client) string) {
+	for member := range room.members {
+		member.Msg(msg(member))
+	}
+}
+
 func (room *Room) StateSave() {
 	room.state_sink <- StateEvent{room.name, room.topic, room.key}
 }
@@ -106,6 +119,7 @@ func (room *Room) Processor(events <-chan ClientEvent) {
 				continue
 			}
 			delete(room.members, client)
+			room.LeaveBattle(client)
 			msg := fmt.Sprintf(":%s PART %s :%s", client, room.name, client.nickname)
 			go room.Broadcast(msg)
 			room.log_sink <- LogEvent{room.name, client.nickname, "left", true}
@@ -119,7 +133,7 @@ func (room *Room) Processor(events <-chan ClientEvent) {
 				continue
 			}
 			room.topic = strings.TrimLeft(event.text, ":")
-			msg := fmt.Sprintf("%s's topic:\n%s", client, room.name, room.topic)
+			msg := fmt.Sprintf("%s's topic:\n%s", room.name, room.topic)
 			go room.Broadcast(msg)
 			room.log_sink <- LogEvent{room.name, client.nickname, "set topic to " + room.topic, true}
 			room.StateSave()
@@ -169,6 +183,26 @@ func (room *Room) Processor(events <-chan ClientEvent) {
 			sep := strings.Index(event.text, " ")
 			room.Broadcast(event.text, client)
 			room.log_sink <- LogEvent{room.name, client.nickname, event.text[sep+1:], false}
+		case EVENT_BATTLE:
+			if _, subscribed := room.members[client]; !subscribed {
+				client.ReplyNicknamed(room.name, "You are not on that channel")
+				continue
+			}
+			room.HandlerBattle(client, event.text)
+		case EVENT_BATTLE_TIMEOUT:
+			if room.battle != nil {
+				room.battle.ReactionTimeout(event.text)
+				if room.battle.state == BATTLE_OVER {
+					room.battle = nil
+				}
+			}
+		case EVENT_BATTLE_AI:
+			if room.battle != nil {
+				room.battle.PlayAI(event.text)
+				if room.battle.state == BATTLE_OVER {
+					room.battle = nil
+				}
+			}
 		}
 	}
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// These are what character files are decoded into before being turned into
+// players. Numbers and booleans can be written natively, or as the quoted
+// strings that older files use; null is the same as leaving a key out.
+
+type PlayerFile struct { // A character file, or the info given to a bot command.
+	Character        *string     `json:"character"`
+	Name             string      `json:"name"` // Unused, but bots in older files have it.
+	Owner            *string     `json:"owner"`
+	Aggressive       *FlexBool   `json:"aggressive"`
+	HP               *FlexInt    `json:"hp"`
+	Info             *InfoFile   `json:"info"`
+	Passives         []MoveEntry `json:"passives"`
+	OptionalPassives []MoveEntry `json:"optional_passives"`
+	Actives          []MoveEntry `json:"actives"`
+}
+
+type InfoFile struct { // A character's info block.
+	Bio            string    `json:"bio"`
+	Aggressive     *FlexBool `json:"aggressive"` // Only read for bots.
+	HP             *FlexInt  `json:"hp"`         // Only read for bots.
+	DiceType       *FlexInt  `json:"diceType"`
+	DiceAmount     *FlexInt  `json:"diceAmount"`
+	DiceValue      *FlexInt  `json:"diceValue"`
+	DiceModAttack  *FlexInt  `json:"diceModAttack"`
+	DiceModDefense *FlexInt  `json:"diceModDefense"`
+	Attack         *FlexInt  `json:"attack"`
+}
+
+type MoveEntry struct { // An entry in a move table, which is either a move or a group of moves.
+	move  *MoveFile
+	group *GroupFile
+}
+
+type MoveFile struct {
+	Use          string        `json:"use"` // A library move this one is based on.
+	Name         string        `json:"name"`
+	PrettyName   string        `json:"prettyname"`
+	Bio          string        `json:"bio"`
+	Instruction  string        `json:"instruction"`
+	Cooldown     FlexInt       `json:"cooldown"`
+	Limit        FlexInt       `json:"limit"`
+	Self         *FlexBool     `json:"self"`
+	Target       string        `json:"target"`
+	Reactive     FlexBool      `json:"reactive"`
+	Conditions   ConditionList `json:"conditions"`
+	Repeat       string        `json:"repeat"`
+	Duration     FlexInt       `json:"duration"` // How many turns its effects last.
+	Stacks       FlexBool      `json:"stacks"`
+	Expires      string        `json:"expires"` // "start" or "end" of the holder's turn.
+	Until        ConditionList `json:"until"`
+	OnActivate   CommandList   `json:"on_activate"`
+	OnDeactivate CommandList   `json:"on_deactivate"`
+}
+
+type GroupFile struct {
+	Group      string        `json:"group"`
+	PrettyName string        `json:"prettyname"`
+	Bio        string        `json:"bio"`
+	Prereq     string        `json:"prereq"`
+	Cooldown   FlexInt       `json:"cooldown"`
+	Limit      FlexInt       `json:"limit"`
+	Self       *FlexBool     `json:"self"`
+	Target     string        `json:"target"`
+	Reactive   FlexBool      `json:"reactive"`
+	Conditions ConditionList `json:"conditions"`
+	Attacks    *[]MoveFile   `json:"attacks"`
+}
+
+type ConditionFile struct {
+	Name  string `json:"name"`
+	Meets string `json:"meets"`
+}
+
+type CommandFile struct {
+	Command   string      `json:"command"`
+	Args      []string    `json:"args"`
+	OnSucceed CommandList `json:"on_succeed"`
+	OnFail    CommandList `json:"on_fail"`
+	Info      *PlayerFile `json:"info"` // Only used by the bot command.
+}
+
+type FlexInt int // A whole number, written as 3 or "3".
+
+type FlexBool bool // Written as true or false, or as "true"/"false"/"yes"/"no".
+
+type CommandList []CommandFile // One command, or an array of them.
+
+type ConditionList []ConditionFile // One condition, or an array of them.
+
+func isNull(data []byte) bool {
+	return string(bytes.TrimSpace(data)) == "null"
+}
+
+func (n *FlexInt) UnmarshalJSON(data []byte) error {
+	if isNull(data) {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	i, err := ParseInt(v)
+	if err != nil {
+		return err
+	}
+	*n = FlexInt(i)
+	return nil
+}
+
+// Numbers in character files are written as numbers, or as strings of them.
+func ParseInt(v interface{}) (int, error) {
+	switch x := v.(type) {
+	case float64:
+		if x != float64(int(x)) {
+			return 0, fmt.Errorf("Expected a whole number, got %v", x)
+		}
+		return int(x), nil
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(x))
+		if err != nil {
+			return 0, fmt.Errorf("Expected a whole number, got %q", x)
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("Expected a whole number, got %s", describeJSON(v))
+}
+
+func (b *FlexBool) UnmarshalJSON(data []byte) error {
+	if isNull(data) {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	value, err := ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*b = FlexBool(value)
+	return nil
+}
+
+func (list *CommandList) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case isNull(data):
+		*list = nil
+	case len(data) > 0 && data[0] == '"':
+		// Older files write "nil" when there's nothing to do.
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s != "nil" && s != "" {
+			return fmt.Errorf("Expected a command, got %q", s)
+		}
+		*list = nil
+	case len(data) > 0 && data[0] == '[':
+		var commands []CommandFile
+		if err := json.Unmarshal(data, &commands); err != nil {
+			return err
+		}
+		*list = commands
+	default:
+		var command CommandFile
+		if err := json.Unmarshal(data, &command); err != nil {
+			return err
+		}
+		*list = CommandList{command}
+	}
+	return nil
+}
+
+func (list *ConditionList) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case isNull(data):
+		*list = nil
+	case len(data) > 0 && data[0] == '[':
+		var conditions []ConditionFile
+		if err := json.Unmarshal(data, &conditions); err != nil {
+			return err
+		}
+		*list = conditions
+	default:
+		var condition ConditionFile
+		if err := json.Unmarshal(data, &condition); err != nil {
+			return err
+		}
+		*list = ConditionList{condition}
+	}
+	return nil
+}
+
+func (move *MoveFile) UnmarshalJSON(data []byte) error {
+	type plainMove MoveFile // So decoding it doesn't come back here.
+	data, err := ResolveLibraryMove(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, (*plainMove)(move))
+}
+
+func (entry *MoveEntry) UnmarshalJSON(data []byte) error {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil || keys == nil {
+		return errors.New("A move has to be an object")
+	}
+	if _, ok := keys["group"]; ok {
+		entry.group = &GroupFile{}
+		return json.Unmarshal(data, entry.group)
+	}
+	entry.move = &MoveFile{}
+	return json.Unmarshal(data, entry.move)
+}
+
+// Decode a character file.
+func DecodePlayer(data []byte) (PlayerFile, error) {
+	var file PlayerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return PlayerFile{}, err
+	}
+	return file, nil
+}
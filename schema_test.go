@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlexInt(t *testing.T) {
+	tests := []struct {
+		json string
+		want FlexInt
+		ok   bool
+	}{
+		{`3`, 3, true},
+		{`"3"`, 3, true},
+		{`" -12 "`, -12, true},
+		{`null`, 0, true},
+		{`2.5`, 0, false},
+		{`"three"`, 0, false},
+		{`true`, 0, false},
+		{`[1]`, 0, false},
+	}
+	for _, test := range tests {
+		var got FlexInt
+		err := json.Unmarshal([]byte(test.json), &got)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.json, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %d, want %d", test.json, got, test.want)
+		}
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+	tests := []struct {
+		json string
+		want FlexBool
+		ok   bool
+	}{
+		{`true`, true, true},
+		{`false`, false, true},
+		{`"true"`, true, true},
+		{`"yes"`, true, true},
+		{`"no"`, false, true},
+		{`null`, false, true},
+		{`"maybe"`, false, false},
+		{`1`, false, false},
+	}
+	for _, test := range tests {
+		var got FlexBool
+		err := json.Unmarshal([]byte(test.json), &got)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.json, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.json, got, test.want)
+		}
+	}
+}
+
+func TestCommandList(t *testing.T) {
+	tests := []struct {
+		json     string
+		commands []string
+		ok       bool
+	}{
+		{`{"command": "attack", "args": ["{opponent}", "2"]}`, []string{"attack"}, true},
+		{`[{"command": "attack"}, {"command": "heal"}]`, []string{"attack", "heal"}, true},
+		{`[]`, nil, true},
+		{`"nil"`, nil, true},
+		{`""`, nil, true},
+		{`null`, nil, true},
+		{`"attack"`, nil, false},
+		{`3`, nil, false},
+	}
+	for _, test := range tests {
+		var got CommandList
+		err := json.Unmarshal([]byte(test.json), &got)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.json, err)
+			continue
+		}
+		if len(got) != len(test.commands) {
+			t.Errorf("%s: got %d commands, want %d", test.json, len(got), len(test.commands))
+			continue
+		}
+		for i, command := range got {
+			if command.Command != test.commands[i] {
+				t.Errorf("%s: command %d is %q, want %q", test.json, i, command.Command, test.commands[i])
+			}
+		}
+	}
+}
+
+func TestDecodePlayer(t *testing.T) {
+	tests := []struct {
+		json       string
+		hp         int
+		aggressive bool
+		ok         bool
+	}{
+		{`{"character": "A", "owner": "*", "aggressive": true, "hp": 20}`, 20, true, true},
+		{`{"character": "A", "owner": "*", "aggressive": "no", "hp": "15"}`, 15, false, true},
+		{`{"character": "A", "owner": "*", "aggressive": "yes", "hp": "15", "actives": null}`, 15, true, true},
+		{`{"character": "A", "hp": "lots"}`, 0, false, false},
+		{`{"character": "A", "actives": [3]}`, 0, false, false},
+		{`[]`, 0, false, false},
+	}
+	for _, test := range tests {
+		file, err := DecodePlayer([]byte(test.json))
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.json, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if file.HP == nil || int(*file.HP) != test.hp {
+			t.Errorf("%s: got hp %v, want %d", test.json, file.HP, test.hp)
+		}
+		if file.Aggressive == nil || bool(*file.Aggressive) != test.aggressive {
+			t.Errorf("%s: got aggressive %v, want %v", test.json, file.Aggressive, test.aggressive)
+		}
+	}
+}
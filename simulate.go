@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+const SIM_MAX_ROUNDS = 100 // How long a simulated battle can go on if -maxrounds doesn't say.
+
+// The simulator plays characters against each other without a server, with
+// the server's NPC AI on every side, so that a new character can be checked
+// for balance before it ships. Each file is its own team.
+
+type SimOptions struct {
+	Battles    int    // How many battles to play.
+	Seed       int64  // The seed for the first battle; each one after uses the next.
+	MaxRounds  int    // Rounds before the team with the most HP wins.
+	Difficulty int    // How well every side is played.
+	Format     string // "text" or "json".
+}
+
+type SimReport struct {
+	Battles       int            `json:"battles"`
+	Draws         int            `json:"draws"`
+	AverageRounds float64        `json:"average_rounds"`
+	Characters    []SimCharacter `json:"characters"`
+}
+
+type SimCharacter struct {
+	Name    string    `json:"name"`
+	File    string    `json:"file"`
+	Wins    int       `json:"wins"`
+	WinRate float64   `json:"win_rate"`
+	Moves   []SimMove `json:"moves"`
+}
+
+type SimMove struct { // How a move did over every battle. Bots' moves are named like "Turret: shoot".
+	Name            string  `json:"name"`
+	Uses            int     `json:"uses"`
+	UsesPerBattle   float64 `json:"uses_per_battle"`
+	Damage          int     `json:"damage"` // Damage to the other sides, before it's capped by their HP.
+	DamagePerBattle float64 `json:"damage_per_battle"`
+	DamagePerUse    float64 `json:"damage_per_use"`
+}
+
+// Play the character files given against each other, print what happened and
+// return the exit status.
+func RunSimulate(filenames []string, options SimOptions) int {
+	var players []Player
+	var files []string
+	for _, filename := range filenames {
+		file, err := os.ReadFile(filename)
+		if err != nil || !IsLibrary(file) {
+			continue
+		}
+		name, moves, err := ParseLibrary(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			return 1
+		}
+		RegisterLibrary(name, moves)
+	}
+	for _, filename := range filenames {
+		if file, err := os.ReadFile(filename); err == nil && IsLibrary(file) {
+			continue
+		}
+		player, err := ReadPlayer(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			return 1
+		}
+		players = append(players, player)
+		files = append(files, filename)
+	}
+	if len(players) < 2 || options.Battles < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: hawaii -simulate [-battles n] [-format text|json] character.json character.json...")
+		return 2
+	}
+	report, err := Simulate(players, files, options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if options.Format == "json" {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(out))
+		return 0
+	}
+	report.Print()
+	return 0
+}
+
+// Play a number of battles between characters and add up how they went.
+func Simulate(players []Player, files []string, options SimOptions) (SimReport, error) {
+	if options.Format != "" && options.Format != "text" && options.Format != "json" {
+		return SimReport{}, errors.New("The format has to be text or json, not " + options.Format)
+	}
+	if options.Seed == 0 {
+		options.Seed = time.Now().UnixNano()
+	}
+	if options.MaxRounds == 0 {
+		options.MaxRounds = SIM_MAX_ROUNDS
+	}
+	report := SimReport{Battles: options.Battles}
+	wins := make([]int, len(players))
+	moves := make([]map[string]*SimMove, len(players))
+	for i := range moves {
+		moves[i] = make(map[string]*SimMove)
+	}
+	// The moves used by a combatant are counted for the file on their team.
+	count := func(c *Combatant, name string) *SimMove {
+		if c.owner != nil {
+			name = c.name + ": " + name
+		}
+		if moves[c.team][name] == nil {
+			moves[c.team][name] = &SimMove{Name: name}
+		}
+		return moves[c.team][name]
+	}
+	rounds := 0
+	for i := 0; i < options.Battles; i++ {
+		battle := &Battle{
+			room:      &Room{name: "simulation", members: make(map[*Client]bool)},
+			state:     BATTLE_PENDING,
+			round:     1,
+			maxRounds: options.MaxRounds,
+			dice:      NewDice(options.Seed + int64(i)),
+			firstTeam: i % len(players), // Take turns going first.
+		}
+		battle.observe = func(event ReplayEvent) {
+			if event.Who < 0 || event.Who >= len(battle.combatants) {
+				return
+			}
+			c := battle.combatants[event.Who]
+			switch event.Event {
+			case "move", "react":
+				count(c, event.Move).Uses++
+			case "damage":
+				if event.Move != "" && len(event.Targets) == 1 && battle.combatants[event.Targets[0]].team != c.team {
+					count(c, event.Move).Damage += event.Damage
+				}
+			}
+		}
+		for team, player := range players {
+			battle.AddCombatant(player, nil, team, options.Difficulty)
+		}
+		battle.Start()
+		for battle.state == BATTLE_ACTIVE {
+			if battle.reaction != nil {
+				battle.ExpireReactions()
+				continue
+			}
+			turn := battle.aiTurns
+			battle.PlayAI(battle.TimerID(turn))
+			if battle.state == BATTLE_ACTIVE && battle.aiTurns == turn {
+				// Whoever's turn it is couldn't do anything, which shouldn't happen.
+				battle.Pass(battle.Current())
+			}
+		}
+		rounds += battle.round
+		if len(battle.winners) == 0 {
+			report.Draws++
+		} else {
+			wins[battle.winners[0].team]++
+		}
+	}
+	report.AverageRounds = float64(rounds) / float64(options.Battles)
+	for i, player := range players {
+		character := SimCharacter{
+			Name:    player.name,
+			File:    files[i],
+			Wins:    wins[i],
+			WinRate: float64(wins[i]) / float64(options.Battles),
+			Moves:   []SimMove{},
+		}
+		for _, move := range moves[i] {
+			move.UsesPerBattle = float64(move.Uses) / float64(options.Battles)
+			move.DamagePerBattle = float64(move.Damage) / float64(options.Battles)
+			if move.Uses > 0 {
+				move.DamagePerUse = float64(move.Damage) / float64(move.Uses)
+			}
+			character.Moves = append(character.Moves, *move)
+		}
+		sort.Slice(character.Moves, func(a, b int) bool {
+			return character.Moves[a].Uses > character.Moves[b].Uses ||
+				character.Moves[a].Uses == character.Moves[b].Uses && character.Moves[a].Name < character.Moves[b].Name
+		})
+		report.Characters = append(report.Characters, character)
+	}
+	return report, nil
+}
+
+func (report SimReport) Print() {
+	fmt.Printf("%d battles, %d %s, %.1f rounds on average\n", report.Battles, report.Draws, plural(report.Draws, "draw", "draws"), report.AverageRounds)
+	for _, character := range report.Characters {
+		fmt.Printf("\n%s (%s): won %d (%.1f%%)\n", character.Name, character.File, character.Wins, character.WinRate*100)
+		fmt.Printf("  %-24s %8s %10s %10s %10s\n", "move", "uses", "per battle", "damage", "per use")
+		for _, move := range character.Moves {
+			fmt.Printf("  %-24s %8d %10.2f %10d %10.2f\n", move.Name, move.Uses, move.UsesPerBattle, move.Damage, move.DamagePerUse)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	DICE_FIXED = -1 // A diceType that means the dice always land on diceValue.
+
+	MAX_HP = 1<<31 - 1 // The most HP a character can start with.
+)
+
+type Stats struct { // The numbers a character fights with.
+	diceType       int // How many sides their defense dice have, or DICE_FIXED.
+	diceAmount     int // How many defense dice they throw.
+	diceValue      int // What they roll when their diceType is DICE_FIXED.
+	diceModAttack  int // Added to their attack rolls.
+	diceModDefense int // Added to their defense rolls.
+	attack         int // Extra damage added to their attacks.
+}
+
+// What a character fights with when their file doesn't say otherwise.
+var defaultStats = Stats{diceType: 20, diceAmount: 1}
+
+// The stats that commands like "add" and "subtract" can change, by the name
+// used for them in character files.
+func (stats *Stats) Field(name string) (*int, error) {
+	switch name {
+	case "diceType":
+		return &stats.diceType, nil
+	case "diceAmount":
+		return &stats.diceAmount, nil
+	case "diceValue":
+		return &stats.diceValue, nil
+	case "diceModAttack":
+		return &stats.diceModAttack, nil
+	case "diceModDefense":
+		return &stats.diceModDefense, nil
+	case "attack":
+		return &stats.attack, nil
+	}
+	return nil, errors.New("There is no stat called " + name)
+}
+
+var statNames = []string{"diceType", "diceAmount", "diceValue", "diceModAttack", "diceModDefense", "attack"}
+
+// Parse a character's info block into their stats and bio.
+func ParseInfo(info InfoFile) (Stats, string, error) {
+	stats := defaultStats
+	for name, value := range map[string]*FlexInt{
+		"diceType":       info.DiceType,
+		"diceAmount":     info.DiceAmount,
+		"diceValue":      info.DiceValue,
+		"diceModAttack":  info.DiceModAttack,
+		"diceModDefense": info.DiceModDefense,
+		"attack":         info.Attack,
+	} {
+		if value == nil {
+			continue
+		}
+		if err := CheckStat(name, int(*value)); err != nil {
+			return Stats{}, "", err
+		}
+		field, _ := stats.Field(name)
+		*field = int(*value)
+	}
+	if err := CheckDiceAmount(stats.diceType, stats.diceAmount); err != nil {
+		return Stats{}, "", err
+	}
+	return stats, info.Bio, nil
+}
+
+// Check how many defense dice a character throws. It doesn't matter when their
+// roll is fixed, since they don't throw any.
+func CheckDiceAmount(diceType, diceAmount int) error {
+	if diceType != DICE_FIXED && (diceAmount < 1 || diceAmount > MAX_DICE) {
+		return fmt.Errorf("diceAmount has to be between 1 and %d, not %d", MAX_DICE, diceAmount)
+	}
+	return nil
+}
+
+// Check that a stat in a character file is one the dice can actually throw.
+func CheckStat(name string, value int) error {
+	switch name {
+	case "diceType":
+		if value != DICE_FIXED && (value < 1 || value > MAX_SIDES) {
+			return fmt.Errorf("diceType has to be between 1 and %d, or -1 for a fixed roll, not %d", MAX_SIDES, value)
+		}
+	default:
+		if value < -1<<31 || value > 1<<31-1 {
+			return fmt.Errorf("%s has to be between %d and %d, not %d", name, -1<<31, 1<<31-1, value)
+		}
+	}
+	return nil
+}
+
+// Check that a character starts with some HP, so they aren't defeated before
+// the battle begins.
+func CheckHP(hp int) error {
+	if hp < 1 || hp > MAX_HP {
+		return fmt.Errorf("hp has to be between 1 and %d, not %d", MAX_HP, hp)
+	}
+	return nil
+}
+
+// Get a pointer to one of the combatant's current stats by name, so commands
+// can change it. Their base stats are never changed during a battle.
+func (combatant *Combatant) Stat(name string) (*int, error) {
+	if name == "hp" {
+		return &combatant.hp, nil
+	}
+	return combatant.stats.Field(name)
+}
+
+// List the stats that are different from the combatant's base stats, like
+// "diceModAttack -5 (base 0)".
+func (combatant *Combatant) DescribeStats() string {
+	changed := []string{}
+	for _, name := range statNames {
+		current, _ := combatant.stats.Field(name)
+		base, _ := combatant.base.Field(name)
+		if *current != *base {
+			changed = append(changed, fmt.Sprintf("%s %d (base %d)", name, *current, *base))
+		}
+	}
+	return strings.Join(changed, ", ")
+}
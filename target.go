@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	TARGET_OPPONENT  = iota // One opponent, picked by the player when there's more than one.
+	TARGET_SELF             // Whoever uses the move.
+	TARGET_ALLY             // One ally other than themselves, picked by the player when there's more than one.
+	TARGET_OPPONENTS        // Every opponent.
+	TARGET_ALLIES           // Them and every ally.
+	TARGET_EVERYONE         // Everybody still standing.
+	TARGET_TEAM             // Every opponent on one team, picked by the player when there's more than one.
+)
+
+// The names used for targets in character files.
+var targetKinds = map[string]int{
+	"opponent":  TARGET_OPPONENT,
+	"self":      TARGET_SELF,
+	"ally":      TARGET_ALLY,
+	"opponents": TARGET_OPPONENTS,
+	"allies":    TARGET_ALLIES,
+	"everyone":  TARGET_EVERYONE,
+	"team":      TARGET_TEAM,
+}
+
+var targetDescriptions = map[int]string{
+	TARGET_OPPONENT:  "targets an opponent",
+	TARGET_SELF:      "targets yourself",
+	TARGET_ALLY:      "targets an ally",
+	TARGET_OPPONENTS: "targets all opponents",
+	TARGET_ALLIES:    "targets your whole side",
+	TARGET_EVERYONE:  "targets everyone",
+	TARGET_TEAM:      "targets an opposing team",
+}
+
+// Work out what a move targets from its "target" and "self" keys. Older files
+// only have "self", which means the move targets whoever uses it.
+func ParseTarget(target string, self *FlexBool) (int, error) {
+	if target == "" {
+		if self != nil && bool(*self) {
+			return TARGET_SELF, nil
+		}
+		return TARGET_OPPONENT, nil
+	}
+	kind, found := targetKinds[target]
+	if !found {
+		return 0, errors.New("Unknown target " + target)
+	}
+	if self != nil && bool(*self) != (kind == TARGET_SELF) {
+		return 0, errors.New("The move says it targets " + target + ", but its self key disagrees")
+	}
+	return kind, nil
+}
+
+// Whether a target is one combatant that the player has to pick.
+func IsChosenTarget(kind int) bool {
+	return kind == TARGET_OPPONENT || kind == TARGET_ALLY
+}
+
+// Whether a name given by a player refers to this combatant: either its
+// character's name, or the nickname of whoever is playing it.
+func (combatant *Combatant) Matches(name string) bool {
+	if strings.EqualFold(combatant.name, name) {
+		return true
+	}
+	return combatant.owner == nil && combatant.client != nil && strings.EqualFold(combatant.client.nickname, name)
+}
+
+// Everybody a move of the given kind could be aimed at.
+func (battle *Battle) TargetCandidates(me *Combatant, kind int) []*Combatant {
+	var candidates []*Combatant
+	switch kind {
+	case TARGET_SELF:
+		candidates = []*Combatant{me}
+	case TARGET_OPPONENT, TARGET_OPPONENTS, TARGET_TEAM:
+		candidates = battle.Opponents(me)
+	case TARGET_ALLY:
+		for _, c := range battle.Allies(me) {
+			if c != me {
+				candidates = append(candidates, c)
+			}
+		}
+	case TARGET_ALLIES:
+		candidates = battle.Allies(me)
+	case TARGET_EVERYONE:
+		for _, c := range battle.combatants {
+			if c.hp > 0 {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	return candidates
+}
+
+// Work out who a move is aimed at. The choice is the name the player gave, if
+// they gave one; it's only needed when the move targets one of several
+// combatants.
+func (battle *Battle) ChooseTargets(me *Combatant, move *Move, choice string) ([]*Combatant, error) {
+	if move.target == TARGET_TEAM {
+		return battle.ChooseTeam(me, move, choice)
+	}
+	candidates := battle.TargetCandidates(me, move.target)
+	if !IsChosenTarget(move.target) {
+		if choice != "" {
+			return nil, errors.New(move.Title() + " " + targetDescriptions[move.target] + ", so you can't pick who it's aimed at.")
+		}
+		if len(candidates) == 0 {
+			return nil, errors.New("There's nobody for " + move.Title() + " to target.")
+		}
+		return candidates, nil
+	}
+	var options [][]*Combatant
+	for _, c := range candidates {
+		options = append(options, []*Combatant{c})
+	}
+	return battle.pickTargets(me, move, options, choice, false)
+}
+
+// Pick one of the groups of combatants a move could be aimed at, either one
+// combatant at a time or a team at a time. The choice can name anybody in a
+// group.
+func (battle *Battle) pickTargets(me *Combatant, move *Move, options [][]*Combatant, choice string, teams bool) ([]*Combatant, error) {
+	if choice != "" {
+		var matches [][]*Combatant
+		for _, option := range options {
+			for _, c := range option {
+				if c.Matches(choice) {
+					matches = append(matches, option)
+					break
+				}
+			}
+		}
+		if len(matches) == 0 && teams {
+			return nil, errors.New(choice + " isn't on a team " + move.Title() + " can target. Pick somebody from: " + describeCombatants(flatten(options)))
+		}
+		if len(matches) == 0 {
+			return nil, errors.New(choice + " isn't somebody " + move.Title() + " can target. Pick one of: " + describeCombatants(flatten(options)))
+		}
+		options = matches
+	}
+	switch len(options) {
+	case 0:
+		return nil, errors.New("There's nobody for " + move.Title() + " to target.")
+	case 1:
+		return options[0], nil
+	}
+	// A reaction is aimed at whoever's attacking, unless the player says otherwise.
+	if current := battle.Current(); choice == "" && current != me {
+		for _, option := range options {
+			for _, c := range option {
+				if c == current {
+					return option, nil
+				}
+			}
+		}
+	}
+	if teams {
+		return nil, errors.New("Pick which team " + move.Title() + " is aimed at with MOVE " + move.name + " <target>, naming anybody on it: " + describeCombatants(flatten(options)))
+	}
+	return nil, errors.New("Pick who " + move.Title() + " is aimed at with MOVE " + move.name + " <target>, one of: " + describeCombatants(flatten(options)))
+}
+
+func flatten(options [][]*Combatant) []*Combatant {
+	var all []*Combatant
+	for _, option := range options {
+		all = append(all, option...)
+	}
+	return all
+}
+
+func describeCombatants(combatants []*Combatant) string {
+	names := []string{}
+	for _, c := range combatants {
+		names = append(names, c.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Split the arguments to MOVE into the move's name and the target picked for
+// it, if any. Move names can have spaces in them, so the last word is only
+// taken as a target when the rest names a move.
+func SplitMoveArgs(combatant *Combatant, args []string) (string, string) {
+	name := strings.Join(args, " ")
+	if move, _ := combatant.FindActive(name); move != nil || len(args) < 2 {
+		return name, ""
+	}
+	return strings.Join(args[:len(args)-1], " "), args[len(args)-1]
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Work out the teams for a challenge from who the challenger named. Nicknames
+// separated by commas are on the same team, and slashes separate teams. The
+// challenger is on the first team, so "bob" is a one-on-one, "carol/bob,dave"
+// is the challenger and carol against bob and dave, and "/bob/carol" is a
+// free-for-all. Without any slashes, everybody named is on the other team.
+func ParseTeams(spec string) [][]string {
+	parts := strings.Split(spec, "/")
+	if len(parts) == 1 {
+		parts = append([]string{""}, parts...)
+	}
+	teams := [][]string{}
+	for _, part := range parts {
+		team := []string{}
+		for _, nick := range strings.Split(part, ",") {
+			if nick = strings.TrimSpace(nick); nick != "" {
+				team = append(team, nick)
+			}
+		}
+		teams = append(teams, team)
+	}
+	return teams
+}
+
+type NPCEntry struct { // An NPC that was named in a challenge.
+	character  string // The NPC's character.
+	team       int    // Which team they're on.
+	difficulty int    // How well the server plays them; one of the AI_ constants.
+}
+
+// Find the clients in a room for a challenge's teams, and which team each of
+// them is on. The challenger is on team 0. Anybody named that isn't in the
+// room can be an NPC instead, like "8-BIT" or "8-BIT:greedy".
+func (room *Room) InviteTeams(challenger *Client, teams [][]string) (map[*Client]int, []NPCEntry, error) {
+	invited := make(map[*Client]int)
+	var npcs []NPCEntry
+	for team, nicks := range teams {
+		if len(nicks) == 0 && team > 0 {
+			return nil, nil, errors.New("Every team needs somebody on it.")
+		}
+		for _, nick := range nicks {
+			var member *Client
+			for c := range room.members {
+				if strings.EqualFold(c.nickname, nick) {
+					member = c
+				}
+			}
+			if member == nil {
+				npc, err := room.ParseNPC(nick, team)
+				if err != nil {
+					return nil, nil, err
+				}
+				npcs = append(npcs, npc)
+				continue
+			}
+			if member == challenger {
+				return nil, nil, errors.New("You can't challenge yourself.")
+			}
+			if _, found := invited[member]; found {
+				return nil, nil, errors.New(member.nickname + " can only be on one team.")
+			}
+			invited[member] = team
+		}
+	}
+	return invited, npcs, nil
+}
+
+// Work out which NPC a challenge named, and how well it should be played.
+func (room *Room) ParseNPC(name string, team int) (NPCEntry, error) {
+	npc := NPCEntry{character: name, team: team, difficulty: room.Difficulty}
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		difficulty, err := ParseDifficulty(name[i+1:])
+		if err != nil {
+			return NPCEntry{}, err
+		}
+		npc.character, npc.difficulty = name[:i], difficulty
+	}
+	player, found := GetPlayer(npc.character)
+	if !found || !player.aggressive {
+		return NPCEntry{}, errors.New(npc.character + " isn't in " + room.name + ", and isn't an NPC")
+	}
+	return npc, nil
+}
+
+// The nicknames of the clients that still have to accept a challenge.
+func (battle *Battle) Waiting() []string {
+	nicks := []string{}
+	for c := range battle.invited {
+		nicks = append(nicks, c.nickname)
+	}
+	sort.Strings(nicks)
+	return nicks
+}
+
+// Everybody on a team that isn't a bot, whether or not they're still standing.
+func (battle *Battle) Team(team int) []*Combatant {
+	var members []*Combatant
+	for _, c := range battle.combatants {
+		if c.team == team && c.owner == nil {
+			members = append(members, c)
+		}
+	}
+	return members
+}
+
+// The teams in the battle, in order, with the combatants on each of them that
+// aren't bots.
+func (battle *Battle) Teams() [][]*Combatant {
+	var teams [][]*Combatant
+	for _, c := range battle.combatants {
+		if c.owner == nil {
+			for len(teams) <= c.team {
+				teams = append(teams, nil)
+			}
+			teams[c.team] = append(teams[c.team], c)
+		}
+	}
+	return teams
+}
+
+// Put the combatants in turn order, taking turns between the teams, so that
+// in a 2v2 the sides alternate. The battle's first team goes first.
+func (battle *Battle) OrderTurns() {
+	teams := battle.Teams()
+	var order []*Combatant
+	for i := 0; len(order) < len(battle.combatants); i++ {
+		for t := range teams {
+			if team := teams[(t+battle.firstTeam)%len(teams)]; i < len(team) {
+				order = append(order, team[i])
+			}
+		}
+	}
+	battle.combatants = order
+}
+
+// Something like "Brawler (alice) & 8-BIT (carol)".
+func describeTeam(members []*Combatant) string {
+	names := []string{}
+	for _, c := range members {
+		names = append(names, c.String())
+	}
+	return strings.Join(names, " & ")
+}
+
+// Something like "Brawler (alice) vs 8-BIT (bob) & Brawler (carol)".
+func (battle *Battle) DescribeTeams() string {
+	teams := []string{}
+	for _, team := range battle.Teams() {
+		if len(team) > 0 {
+			teams = append(teams, describeTeam(team))
+		}
+	}
+	return strings.Join(teams, " vs ")
+}
+
+// The teams that still have somebody standing. Bots don't count, since they
+// leave the battle along with whoever summoned them.
+func (battle *Battle) StandingTeams() []int {
+	var standing []int
+	for team, members := range battle.Teams() {
+		for _, c := range members {
+			if c.hp > 0 {
+				standing = append(standing, team)
+				break
+			}
+		}
+	}
+	return standing
+}
+
+// End the battle in favour of a team.
+func (battle *Battle) Win(team int) {
+	members := battle.Team(team)
+	battle.winners = members
+	if len(members) == 1 {
+		battle.End(fmt.Sprintf("%s wins the battle!", members[0]))
+	} else {
+		battle.End(fmt.Sprintf("%s win the battle!", describeTeam(members)))
+	}
+}
+
+// End the battle once it's gone on for too many rounds. Whichever team has
+// the most HP left between them wins.
+func (battle *Battle) TimeUp() {
+	battle.Announce(fmt.Sprintf("Time's up after %d %s!", battle.maxRounds, plural(battle.maxRounds, "round", "rounds")))
+	best, bestHP, tied := -1, 0, false
+	for _, team := range battle.StandingTeams() {
+		hp := 0
+		for _, c := range battle.Team(team) {
+			if c.hp > 0 {
+				hp += c.hp
+			}
+		}
+		switch {
+		case best == -1 || hp > bestHP:
+			best, bestHP, tied = team, hp, false
+		case hp == bestHP:
+			tied = true
+		}
+	}
+	if best == -1 || tied {
+		battle.End("The battle is a draw.")
+		return
+	}
+	battle.Win(best)
+}
+
+// Work out which opposing team a move is aimed at. The choice can name anybody
+// on it, and is only needed when there's more than one opposing team.
+func (battle *Battle) ChooseTeam(me *Combatant, move *Move, choice string) ([]*Combatant, error) {
+	return battle.pickTargets(me, move, battle.OpposingTeams(me), choice, true)
+}
+
+// The combatants a combatant is fighting that are still standing, a team at
+// a time.
+func (battle *Battle) OpposingTeams(me *Combatant) [][]*Combatant {
+	var teams []int
+	byTeam := make(map[int][]*Combatant)
+	for _, c := range battle.Opponents(me) {
+		if byTeam[c.team] == nil {
+			teams = append(teams, c.team)
+		}
+		byTeam[c.team] = append(byTeam[c.team], c)
+	}
+	var options [][]*Combatant
+	for _, team := range teams {
+		options = append(options, byTeam[team])
+	}
+	return options
+}
+
+// Whether a client has been challenged, and hasn't accepted yet.
+func (battle *Battle) IsInvited(client *Client) bool {
+	_, found := battle.invited[client]
+	return found
+}
+
+// Something like "alice & carol vs bob & dave", for a challenge that hasn't
+// been accepted yet.
+func DescribeChallenge(challenger *Client, invited map[*Client]int, npcs []NPCEntry) string {
+	teams := [][]string{{challenger.nickname}}
+	add := func(name string, team int) {
+		for len(teams) <= team {
+			teams = append(teams, nil)
+		}
+		teams[team] = append(teams[team], name)
+	}
+	for c, team := range invited {
+		add(c.nickname, team)
+	}
+	for _, npc := range npcs {
+		add(npc.character, npc.team)
+	}
+	described := []string{}
+	for i, team := range teams {
+		if i == 0 {
+			sort.Strings(team[1:])
+		} else {
+			sort.Strings(team)
+		}
+		described = append(described, strings.Join(team, " & "))
+	}
+	return strings.Join(described, " vs ")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+)
+
+// Render text written from the point of view of a character, such as a move's
+// bio. Whoever controls the character reads "you" and "your", and everybody
+// else reads the character's name instead.
+func RenderText(text, name string, viewerIsOwner bool) string {
+	if !strings.Contains(text, "{tense:") {
+		return text
+	}
+	possessive := name + "'s"
+	if strings.HasSuffix(name, "s") {
+		possessive = name + "'"
+	}
+	var replacer *strings.Replacer
+	if viewerIsOwner {
+		replacer = strings.NewReplacer(
+			"{tense:you}", "you",
+			"{tense:your}", "your",
+			"{tense:yours}", "yours",
+			"{tense:yourself}", "yourself",
+		)
+	} else {
+		replacer = strings.NewReplacer(
+			"{tense:you}", name,
+			"{tense:your}", possessive,
+			"{tense:yours}", possessive,
+			"{tense:yourself}", name,
+		)
+	}
+	return replacer.Replace(text)
+}
+
+func (move Move) Bio(name string, viewerIsOwner bool) string {
+	return RenderText(move.bio, name, viewerIsOwner)
+}
+
+func (move Move) Instruction(name string, viewerIsOwner bool) string {
+	return RenderText(move.instruction, name, viewerIsOwner)
+}
+
+func (group Group) Bio(name string, viewerIsOwner bool) string {
+	return RenderText(group.bio, name, viewerIsOwner)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	MAX_UPLOAD_SIZE = 64 * 1024 // The biggest character file that can be uploaded, in bytes.
+	MAX_UPLOADS     = 10        // How many characters one nickname can have uploaded at once.
+)
+
+// Make a name safe to use as a filename.
+func safeFilename(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	if safe == "" {
+		return "_"
+	}
+	return safe
+}
+
+// Rewrite the owner of a character file, leaving everything else as it was.
+// The owner's value is swapped in place, or added at the top of the object,
+// so the rest of the file keeps the uploader's own layout.
+func SetOwner(file []byte, owner string) ([]byte, error) {
+	value, _ := json.Marshal(owner)
+	dec := json.NewDecoder(bytes.NewReader(file))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return nil, errors.New("A character file has to be a JSON object")
+	}
+	open := int(dec.InputOffset())
+	empty := !dec.More()
+	var owners [][2]int // Where each top-level owner value starts and ends.
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, errors.New("Could not unmarshal the player file: \n" + err.Error())
+		}
+		start := int(dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, errors.New("Could not unmarshal the player file: \n" + err.Error())
+		}
+		end := int(dec.InputOffset())
+		if key == "owner" {
+			start = end - len(bytes.TrimLeft(file[start:end], " \t\r\n:"))
+			owners = append(owners, [2]int{start, end})
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, errors.New("Could not unmarshal the player file: \n" + err.Error())
+	}
+
+	var out []byte
+	if len(owners) == 0 {
+		// Indent the new field like the one after it.
+		space := file[open : len(file)-len(bytes.TrimLeft(file[open:], " \t\r\n"))]
+		out = append(out, file[:open]...)
+		out = append(out, space...)
+		out = append(out, `"owner": `...)
+		out = append(out, value...)
+		if !empty {
+			out = append(out, ',')
+		}
+		return append(out, file[open:]...), nil
+	}
+	last := 0
+	for _, owner := range owners {
+		out = append(out, file[last:owner[0]]...)
+		out = append(out, value...)
+		last = owner[1]
+	}
+	return append(out, file[last:]...), nil
+}
+
+// Load the characters that were uploaded before the server last started.
+// Anything that clashes with a shared character is left alone.
+func LoadUploads(dir string) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if err != nil {
+		log.Println("Can not read uploaddir", dir, err)
+		return
+	}
+	for _, filename := range filenames {
+		player, err := ReadPlayer(filename)
+		if err != nil {
+			log.Printf("Can not load uploaded character %s: %v", filename, err)
+			continue
+		}
+		if existing, found := GetPlayer(player.name); found && existing.owner != player.owner {
+			log.Printf("Not loading %s, since %s is already taken", filename, player.name)
+			continue
+		}
+		RegisterPlayer(player)
+		log.Printf("Loaded %s's %s from %s", player.owner, player.name, filename)
+	}
+}
+
+func (daemon *Daemon) IsAdmin(client *Client) bool {
+	return daemon.admins[strings.ToLower(client.nickname)]
+}
+
+// UPLOAD BEGIN starts an upload, each UPLOAD <line> after that adds a line of
+// the character file, and UPLOAD END finishes it. UPLOAD ABORT gives up.
+func (daemon *Daemon) HandlerUpload(client *Client, cols []string) {
+	if daemon.upload_dir == "" {
+		client.ReplyNicknamed("Uploads are turned off on this server.")
+		return
+	}
+	if len(cols) == 1 {
+		client.ReplyNotEnoughParameters("UPLOAD")
+		return
+	}
+	text := cols[1]
+	buf, uploading := daemon.uploads[client]
+	switch strings.ToUpper(strings.TrimSpace(text)) {
+	case "BEGIN":
+		daemon.uploads[client] = &bytes.Buffer{}
+		client.ReplyNicknamed("Send your character file a line at a time with UPLOAD <line>, then UPLOAD END, or UPLOAD ABORT to give up.")
+	case "ABORT":
+		delete(daemon.uploads, client)
+		client.ReplyNicknamed("Upload cancelled.")
+	case "END":
+		if !uploading {
+			client.ReplyNicknamed("Start an upload with UPLOAD BEGIN first.")
+			return
+		}
+		delete(daemon.uploads, client)
+		player, err := daemon.SaveUpload(client, buf.Bytes())
+		if err != nil {
+			client.ReplyNicknamed("Upload failed: " + strings.Join(strings.Fields(err.Error()), " "))
+			return
+		}
+		client.ReplyNicknamed(fmt.Sprintf("Uploaded %s. Only you can play as them until an admin approves them.", player.name))
+		for c := range daemon.clients {
+			if c != client && daemon.IsAdmin(c) {
+				c.ReplyNicknamed(fmt.Sprintf("%s uploaded %s. Use APPROVE %s to share them with everybody.", client.nickname, player.name, player.name))
+			}
+		}
+	default:
+		if !uploading {
+			client.ReplyNicknamed("Start an upload with UPLOAD BEGIN first.")
+			return
+		}
+		if buf.Len()+len(text)+1 > MAX_UPLOAD_SIZE {
+			delete(daemon.uploads, client)
+			client.ReplyNicknamed(fmt.Sprintf("Upload failed: character files can't be bigger than %d bytes.", MAX_UPLOAD_SIZE))
+			return
+		}
+		buf.WriteString(text + "\n")
+	}
+}
+
+// Check an uploaded character file with the same loader as the shared ones,
+// then store it under the uploader's nickname and make it available to them.
+func (daemon *Daemon) SaveUpload(client *Client, file []byte) (Player, error) {
+	file, err := SetOwner(file, client.nickname)
+	if err != nil {
+		return Player{}, err
+	}
+	player, err := ParsePlayer(file)
+	if err != nil {
+		return Player{}, err
+	}
+	if existing, found := GetPlayer(player.name); found && existing.owner != player.owner {
+		return Player{}, errors.New("There's already a character called " + player.name)
+	}
+
+	dir := filepath.Join(daemon.upload_dir, safeFilename(client.nickname))
+	filename := filepath.Join(dir, safeFilename(player.name)+".json")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Println("Can not create upload directory", dir, err)
+		return Player{}, errors.New("The server couldn't store your character")
+	}
+	existing, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	replacing := false
+	for _, other := range existing {
+		replacing = replacing || other == filename
+	}
+	if len(existing) >= MAX_UPLOADS && !replacing {
+		return Player{}, fmt.Errorf("You can't have more than %d characters uploaded at once", MAX_UPLOADS)
+	}
+	if err := os.WriteFile(filename, file, 0644); err != nil {
+		log.Println("Can not write uploaded character", filename, err)
+		return Player{}, errors.New("The server couldn't store your character")
+	}
+	RegisterPlayer(player)
+	log.Printf("%s uploaded %s to %s", client.nickname, player.name, filename)
+	return player, nil
+}
+
+// APPROVE <character> lets an admin share an uploaded character with everybody,
+// by moving it into the directory of shared characters.
+func (daemon *Daemon) HandlerApprove(client *Client, cols []string) {
+	if !daemon.IsAdmin(client) {
+		client.ReplyNicknamed("Only admins can approve characters.")
+		return
+	}
+	if len(cols) == 1 || strings.TrimSpace(cols[1]) == "" {
+		client.ReplyNotEnoughParameters("APPROVE")
+		return
+	}
+	name := strings.TrimSpace(cols[1])
+	player, found := GetPlayer(name)
+	if !found {
+		client.ReplyNicknamed("There is no character named " + name)
+		return
+	}
+	uploaded := filepath.Join(daemon.upload_dir, safeFilename(player.owner), safeFilename(player.name)+".json")
+	file, err := os.ReadFile(uploaded)
+	if daemon.upload_dir == "" || player.owner == "*" || err != nil {
+		client.ReplyNicknamed(name + " isn't waiting to be approved.")
+		return
+	}
+	file, err = SetOwner(file, "*")
+	if err == nil {
+		player, err = ParsePlayer(file)
+	}
+	if err != nil {
+		client.ReplyNicknamed("Can't approve " + name + ": " + strings.Join(strings.Fields(err.Error()), " "))
+		return
+	}
+	shared := filepath.Join(daemon.player_dir, safeFilename(player.name)+".json")
+	if _, err := os.Stat(shared); err == nil {
+		client.ReplyNicknamed("Can't approve " + name + ", since " + shared + " already exists.")
+		return
+	}
+	if err := os.WriteFile(shared, file, 0644); err != nil {
+		log.Println("Can not write approved character", shared, err)
+		client.ReplyNicknamed("The server couldn't store " + name)
+		return
+	}
+	os.Remove(uploaded)
+	RegisterPlayer(player)
+	log.Printf("%s approved %s, moving it to %s", client.nickname, player.name, shared)
+	client.ReplyNicknamed(name + " can now be played by everybody.")
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestSetOwner(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+		ok   bool
+	}{
+		{"{\n\t\"character\": \"A\",\n\t\"owner\": \"*\"\n}\n", "{\n\t\"character\": \"A\",\n\t\"owner\": \"bob\"\n}\n", true},
+		{"{\n\t\"character\": \"A\"\n}\n", "{\n\t\"owner\": \"bob\",\n\t\"character\": \"A\"\n}\n", true},
+		{`{"owner" : null, "info": {"owner": "x"}}`, `{"owner" : "bob", "info": {"owner": "x"}}`, true},
+		{`{}`, `{"owner": "bob"}`, true},
+		{`[]`, "", false},
+		{`{"character": `, "", false},
+	}
+	for _, test := range tests {
+		got, err := SetOwner([]byte(test.file), "bob")
+		if (err == nil) != test.ok {
+			t.Errorf("%q: got error %v", test.file, err)
+		} else if string(got) != test.want {
+			t.Errorf("%q: got %q, want %q", test.file, got, test.want)
+		}
+	}
+}
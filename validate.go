@@ -0,0 +1,598 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ValidationError struct { // Something wrong with a character file.
+	path string // A JSON pointer to where the problem is, like "/actives/0/cooldown".
+	msg  string // What the problem is.
+}
+
+func (err ValidationError) String() string {
+	if err.path == "" {
+		return err.msg
+	}
+	return err.path + ": " + err.msg
+}
+
+type Validator struct { // Walks a character file, collecting every problem in it.
+	errs    []ValidationError
+	scopes  []map[string]bool      // The move names defined by each character, the innermost last.
+	repeats []map[string]repeatRef // The "repeat" references made by each character, by path.
+}
+
+type repeatRef struct { // A move that repeats another.
+	from string // The move doing the repeating.
+	to   string // The move it repeats.
+}
+
+// The keys that each kind of object in a character file can have, which are
+// whatever the loader decodes for it.
+var (
+	playerKeys    = jsonKeys(PlayerFile{})
+	infoKeys      = jsonKeys(InfoFile{})
+	libraryKeys   = jsonKeys(LibraryFile{})
+	moveKeys      = jsonKeys(MoveFile{})
+	groupKeys     = jsonKeys(GroupFile{})
+	conditionKeys = jsonKeys(ConditionFile{})
+	commandKeys   = jsonKeys(CommandFile{})
+)
+
+// The JSON keys of a struct's fields.
+func jsonKeys(v interface{}) map[string]bool {
+	set := make(map[string]bool)
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		if key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; key != "" && key != "-" {
+			set[key] = true
+		}
+	}
+	return set
+}
+
+// Escape a key for use in a JSON pointer, as in RFC 6901.
+func pointerEscape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func (v *Validator) errorf(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{path, fmt.Sprintf(format, args...)})
+}
+
+// Check a character file, returning every problem found in it.
+func ValidateFile(filename string) []ValidationError {
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return []ValidationError{{"", "Couldn't read the file: " + err.Error()}}
+	}
+	return ValidateJSON(file)
+}
+
+func ValidateJSON(file []byte) []ValidationError {
+	var doc interface{}
+	if err := json.Unmarshal(file, &doc); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line := 1 + strings.Count(string(file[:syntax.Offset]), "\n")
+			return []ValidationError{{"", fmt.Sprintf("Invalid JSON on line %d: %s", line, err.Error())}}
+		}
+		return []ValidationError{{"", "Invalid JSON: " + err.Error()}}
+	}
+	v := &Validator{}
+	if o, ok := doc.(map[string]interface{}); ok && o["library"] != nil {
+		v.library("", doc)
+	} else {
+		v.player("", doc, false)
+	}
+	return v.errs
+}
+
+func (v *Validator) object(path string, value interface{}, keys map[string]bool) (map[string]interface{}, bool) {
+	o, ok := value.(map[string]interface{})
+	if !ok {
+		v.errorf(path, "Expected an object, got %s", describeJSON(value))
+		return nil, false
+	}
+	unknown := []string{}
+	for key := range o {
+		if !keys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		v.errorf(path+"/"+pointerEscape(key), "Unknown key %q", key)
+	}
+	return o, true
+}
+
+func (v *Validator) stringValue(path string, value interface{}) (string, bool) {
+	s, ok := value.(string)
+	if !ok {
+		v.errorf(path, "Expected a string, got %s", describeJSON(value))
+	}
+	return s, ok
+}
+
+// Check a number with the same rule the loader uses for it.
+func (v *Validator) checkedInt(path string, value interface{}, check func(n int) error) {
+	n, err := ParseInt(value)
+	if err == nil {
+		err = check(n)
+	}
+	if err != nil {
+		v.errorf(path, "%s", err.Error())
+	}
+}
+
+func (v *Validator) boolValue(path string, value interface{}) {
+	if _, err := ParseBool(value); err != nil {
+		v.errorf(path, "%s", err.Error())
+	}
+}
+
+func (v *Validator) player(path string, value interface{}, bot bool) {
+	o, ok := v.object(path, value, playerKeys)
+	if !ok {
+		return
+	}
+	if o["character"] == nil {
+		v.errorf(path, "Missing \"character\"")
+	} else {
+		v.stringValue(path+"/character", o["character"])
+	}
+	if o["name"] != nil {
+		v.stringValue(path+"/name", o["name"])
+	}
+	if o["owner"] == nil && !bot {
+		v.errorf(path, "Missing \"owner\"")
+	} else if o["owner"] != nil {
+		v.stringValue(path+"/owner", o["owner"])
+	}
+	info, _ := o["info"].(map[string]interface{})
+	if o["aggressive"] == nil && (!bot || info["aggressive"] == nil) {
+		v.errorf(path, "Missing \"aggressive\"")
+	} else if o["aggressive"] != nil {
+		v.boolValue(path+"/aggressive", o["aggressive"])
+	}
+	if o["hp"] != nil {
+		v.checkedInt(path+"/hp", o["hp"], CheckHP)
+	}
+	if o["info"] != nil {
+		v.info(path+"/info", o["info"])
+	}
+
+	v.scopes = append(v.scopes, v.moveNames(o))
+	v.repeats = append(v.repeats, make(map[string]repeatRef))
+	for _, key := range []string{"passives", "optional_passives", "actives"} {
+		if o[key] != nil {
+			v.moveTable(path+"/"+key, o[key], key == "actives")
+		}
+	}
+	scope, repeats := v.scopes[len(v.scopes)-1], v.repeats[len(v.repeats)-1]
+	v.scopes, v.repeats = v.scopes[:len(v.scopes)-1], v.repeats[:len(v.repeats)-1]
+	paths := []string{}
+	for p := range repeats {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if !scope[repeats[p].to] {
+			v.errorf(p, "Repeats %q, but this character has no move with that name", repeats[p].to)
+		}
+	}
+	v.repeatCycles(paths, repeats)
+}
+
+// Report every chain of repeats that leads back to a move already in it, at
+// the repeat that closes the loop.
+func (v *Validator) repeatCycles(paths []string, repeats map[string]repeatRef) {
+	// Like the loader, a name means the first move that has it.
+	next := make(map[string]string)
+	for _, p := range paths {
+		if _, found := next[repeats[p].from]; !found {
+			next[repeats[p].from] = p
+		}
+	}
+	reported := make(map[string]bool)
+	for _, p := range paths {
+		chain := []string{repeats[p].from}
+		seen := map[string]bool{repeats[p].from: true}
+		var walked []string
+		for current := p; current != ""; current = next[repeats[current].to] {
+			to := repeats[current].to
+			chain = append(chain, to)
+			walked = append(walked, current)
+			if seen[to] {
+				// Each loop is only reported once, from wherever it's first found.
+				if !reported[current] {
+					v.errorf(current, "Repeats %q, which leads back here: %s", to, strings.Join(chain, " -> "))
+				}
+				for _, w := range walked {
+					reported[w] = true
+				}
+				break
+			}
+			seen[to] = true
+		}
+	}
+}
+
+// Every move name a character defines, so "repeat" references can be checked.
+func (v *Validator) moveNames(o map[string]interface{}) map[string]bool {
+	names := make(map[string]bool)
+	add := func(entry interface{}) {
+		if m, ok := entry.(map[string]interface{}); ok {
+			if name := moveName(m); name != "" {
+				names[name] = true
+			}
+		}
+	}
+	for _, key := range []string{"passives", "optional_passives", "actives"} {
+		table, _ := o[key].([]interface{})
+		for _, entry := range table {
+			add(entry)
+			if m, ok := entry.(map[string]interface{}); ok {
+				attacks, _ := m["attacks"].([]interface{})
+				for _, attack := range attacks {
+					add(attack)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// The name of a move as it's written. Moves that use a library move get its
+// name unless they give their own.
+func moveName(m map[string]interface{}) string {
+	if name, ok := m["name"].(string); ok {
+		return name
+	}
+	if use, ok := m["use"].(string); ok {
+		var libraryMove struct {
+			Name string `json:"name"`
+		}
+		if raw, found := GetLibraryMove(use); found && json.Unmarshal(raw, &libraryMove) == nil {
+			return libraryMove.Name
+		}
+	}
+	return ""
+}
+
+func (v *Validator) library(path string, value interface{}) {
+	o, ok := v.object(path, value, libraryKeys)
+	if !ok {
+		return
+	}
+	if name, ok := v.stringValue(path+"/library", o["library"]); ok && (name == "" || strings.Contains(name, ".")) {
+		v.errorf(path+"/library", "A library needs a name without dots in it")
+	}
+	moves, ok := o["moves"].([]interface{})
+	if !ok {
+		v.errorf(path, "Missing a \"moves\" array")
+		return
+	}
+	for i, move := range moves {
+		v.move(path+"/moves/"+strconv.Itoa(i), move)
+	}
+}
+
+func (v *Validator) info(path string, value interface{}) {
+	o, ok := v.object(path, value, infoKeys)
+	if !ok {
+		return
+	}
+	keys := []string{}
+	for key := range o {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	diceType := defaultStats.diceType
+	if n, err := ParseInt(o["diceType"]); err == nil {
+		diceType = n
+	}
+	for _, key := range keys {
+		value := o[key]
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "bio":
+			v.stringValue(path+"/bio", value)
+		case "aggressive":
+			v.boolValue(path+"/aggressive", value)
+		case "hp":
+			v.checkedInt(path+"/hp", value, CheckHP)
+		case "diceAmount":
+			v.checkedInt(path+"/diceAmount", value, func(n int) error { return CheckDiceAmount(diceType, n) })
+		default:
+			v.checkedInt(path+"/"+key, value, func(n int) error { return CheckStat(key, n) })
+		}
+	}
+}
+
+func (v *Validator) moveTable(path string, value interface{}, allowGroups bool) {
+	table, ok := value.([]interface{})
+	if !ok {
+		v.errorf(path, "Expected an array of moves, got %s", describeJSON(value))
+		return
+	}
+	for i, entry := range table {
+		entryPath := path + "/" + strconv.Itoa(i)
+		if IsGroup(entry) {
+			if !allowGroups {
+				v.errorf(entryPath, "Only actives can be grouped")
+			}
+			v.group(entryPath, entry)
+		} else {
+			v.move(entryPath, entry)
+		}
+	}
+}
+
+func (v *Validator) usage(path string, o map[string]interface{}) {
+	for _, key := range []string{"cooldown", "limit"} {
+		if o[key] != nil {
+			v.checkedInt(path+"/"+key, o[key], func(n int) error { return CheckCount(key, "", n) })
+		}
+	}
+	for _, key := range []string{"self", "reactive"} {
+		if o[key] != nil {
+			v.boolValue(path+"/"+key, o[key])
+		}
+	}
+	if o["conditions"] != nil {
+		v.conditions(path+"/conditions", o["conditions"])
+	}
+	if o["target"] != nil {
+		if target, ok := v.stringValue(path+"/target", o["target"]); ok {
+			if _, found := targetKinds[target]; !found {
+				v.errorf(path+"/target", "Unknown target %q", target)
+			}
+		}
+	}
+}
+
+func (v *Validator) move(path string, value interface{}) {
+	o, ok := v.object(path, value, moveKeys)
+	if !ok {
+		return
+	}
+	if o["use"] != nil {
+		if len(v.repeats) == 0 {
+			v.errorf(path+"/use", "Moves in a library can't use other library moves")
+		} else if use, ok := v.stringValue(path+"/use", o["use"]); ok {
+			if _, found := GetLibraryMove(use); !found {
+				v.errorf(path+"/use", "Unknown library move %q", use)
+			}
+		}
+	} else if o["name"] == nil {
+		v.errorf(path, "Missing \"name\"")
+	}
+	for _, key := range []string{"name", "prettyname", "bio", "instruction"} {
+		if o[key] != nil {
+			v.stringValue(path+"/"+key, o[key])
+		}
+	}
+	v.usage(path, o)
+	if o["repeat"] != nil {
+		if name, ok := v.stringValue(path+"/repeat", o["repeat"]); ok && len(v.repeats) > 0 {
+			v.repeats[len(v.repeats)-1][path+"/repeat"] = repeatRef{moveName(o), name}
+		}
+	}
+	if o["duration"] != nil {
+		v.checkedInt(path+"/duration", o["duration"], func(n int) error { return CheckCount("duration", "", n) })
+	}
+	if o["stacks"] != nil {
+		v.boolValue(path+"/stacks", o["stacks"])
+	}
+	if o["expires"] != nil {
+		if expires, ok := v.stringValue(path+"/expires", o["expires"]); ok {
+			if _, err := ParseExpires(expires); err != nil {
+				v.errorf(path+"/expires", "Expected \"start\" or \"end\", got %q", expires)
+			}
+		}
+	}
+	if o["until"] != nil {
+		v.conditions(path+"/until", o["until"])
+	}
+	for _, key := range []string{"on_activate", "on_deactivate"} {
+		if o[key] != nil {
+			v.commands(path+"/"+key, o[key])
+		}
+	}
+}
+
+func (v *Validator) group(path string, value interface{}) {
+	o, ok := v.object(path, value, groupKeys)
+	if !ok {
+		return
+	}
+	for _, key := range []string{"group", "prettyname", "bio", "prereq"} {
+		if o[key] != nil {
+			v.stringValue(path+"/"+key, o[key])
+		}
+	}
+	v.usage(path, o)
+	attacks, ok := o["attacks"].([]interface{})
+	if !ok {
+		v.errorf(path, "Missing an \"attacks\" array")
+		return
+	}
+	for i, attack := range attacks {
+		v.move(path+"/attacks/"+strconv.Itoa(i), attack)
+	}
+}
+
+func (v *Validator) conditions(path string, value interface{}) {
+	list, isList := value.([]interface{})
+	if !isList {
+		v.condition(path, value)
+		return
+	}
+	for i, condition := range list {
+		v.condition(path+"/"+strconv.Itoa(i), condition)
+	}
+}
+
+func (v *Validator) condition(path string, value interface{}) {
+	o, ok := v.object(path, value, conditionKeys)
+	if !ok {
+		return
+	}
+	if o["name"] != nil {
+		v.stringValue(path+"/name", o["name"])
+	}
+	if o["meets"] == nil {
+		v.errorf(path, "Missing \"meets\"")
+	} else if meets, ok := v.stringValue(path+"/meets", o["meets"]); ok {
+		if _, _, err := lookupCondition(meets); err != nil {
+			v.errorf(path+"/meets", "%s", err.Error())
+		}
+	}
+}
+
+// Commands can be given as one object or an array of them, or as "nil" in
+// older files.
+func (v *Validator) commands(path string, value interface{}) {
+	switch x := value.(type) {
+	case []interface{}:
+		for i, command := range x {
+			v.command(path+"/"+strconv.Itoa(i), command)
+		}
+	case string:
+		if x != "nil" && x != "" {
+			v.errorf(path, "Expected a command, got %q", x)
+		}
+	default:
+		v.command(path, value)
+	}
+}
+
+func (v *Validator) command(path string, value interface{}) {
+	o, ok := v.object(path, value, commandKeys)
+	if !ok {
+		return
+	}
+	var name string
+	var verb Verb
+	var known bool
+	if o["command"] == nil {
+		v.errorf(path, "Missing \"command\"")
+	} else if name, ok = v.stringValue(path+"/command", o["command"]); ok {
+		verb, known = recognizedVerbs[name]
+		if !known {
+			v.errorf(path+"/command", "Unknown command %q", name)
+		}
+	}
+	args, isList := o["args"].([]interface{})
+	if o["args"] != nil && !isList {
+		v.errorf(path+"/args", "Expected an array of strings, got %s", describeJSON(o["args"]))
+	}
+	for i, arg := range args {
+		argPath := path + "/args/" + strconv.Itoa(i)
+		if s, ok := v.stringValue(argPath, arg); ok {
+			names, err := Placeholders(s)
+			if err != nil {
+				v.errorf(argPath, "%s", err.Error())
+			}
+			for _, placeholder := range names {
+				if !numberPlaceholders[placeholder] && !targetPlaceholders[placeholder] {
+					v.errorf(argPath, "Undefined placeholder {%s}", placeholder)
+				}
+			}
+		}
+	}
+	if known && len(args) < verb.minArgs {
+		v.errorf(path, "The %s command needs at least %d args, but got %d", name, verb.minArgs, len(args))
+	}
+	if o["info"] != nil {
+		if name != "bot" {
+			v.errorf(path+"/info", "Only the bot command takes info")
+		}
+		v.player(path+"/info", o["info"], true)
+	} else if name == "bot" {
+		v.errorf(path, "The bot command needs info about the character to summon")
+	}
+	for _, key := range []string{"on_succeed", "on_fail"} {
+		if o[key] != nil {
+			v.commands(path+"/"+key, o[key])
+		}
+	}
+}
+
+func describeJSON(value interface{}) string {
+	switch x := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return strconv.Quote(x)
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// Validate each of the given files, printing every problem found. Returns the
+// exit status for the process.
+func RunValidate(filenames []string) int {
+	if len(filenames) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hawaii -validate file.json...")
+		return 2
+	}
+	// Load the libraries first, so that characters can use their moves.
+	libraries := make(map[string]bool)
+	for _, filename := range filenames {
+		file, err := os.ReadFile(filename)
+		if err != nil || !IsLibrary(file) {
+			continue
+		}
+		libraries[filename] = true
+		if name, moves, err := ParseLibrary(file); err == nil {
+			RegisterLibrary(name, moves)
+		}
+	}
+	status := 0
+	for _, filename := range filenames {
+		errs := ValidateFile(filename)
+		if len(errs) == 0 {
+			// Anything the walk missed will still be caught by the real loader.
+			var err error
+			if libraries[filename] {
+				var file []byte
+				if file, err = os.ReadFile(filename); err == nil {
+					_, _, err = ParseLibrary(file)
+				}
+			} else {
+				_, err = ReadPlayer(filename)
+			}
+			if err != nil {
+				errs = append(errs, ValidationError{"", strings.ReplaceAll(err.Error(), "\n", " ")})
+			}
+		}
+		if len(errs) == 0 {
+			fmt.Printf("%s: OK\n", filename)
+			continue
+		}
+		status = 1
+		for _, err := range errs {
+			fmt.Printf("%s: %s\n", filename, err)
+		}
+	}
+	return status
+}